@@ -4,15 +4,45 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/go-routeros/routeros/v3/proto"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// bgpStates are the values of mikrotik_bgp_state, the BGP FSM states numbered
+// as in RFC 4273.
+var bgpStates = map[string]float64{
+	"idle":        1,
+	"connect":     2,
+	"active":      3,
+	"opensent":    4,
+	"openconfirm": 5,
+	"established": 6,
+}
+
+// bgpV7Props maps the RouterOS 6 peer properties the metrics are named after to
+// the RouterOS 7 session properties.
+var bgpV7Props = map[string]string{
+	"remote-as":         "remote.as",
+	"remote-address":    "remote.address",
+	"local-address":     "local.address",
+	"messages-sent":     "local.messages",
+	"messages-received": "remote.messages",
+}
+
 type bgpCollector struct {
-	props        []string
+	v6Props      []string
+	v7Props      []string
+	metricProps  []string
 	descriptions map[string]*prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "bgp",
+		newCollector: newBGPCollector,
+		description:  "BGP session state, prefixes and messages",
+	})
+}
+
 func newBGPCollector() routerOSCollector {
 	c := &bgpCollector{}
 	c.init()
@@ -20,15 +50,21 @@ func newBGPCollector() routerOSCollector {
 }
 
 func (c *bgpCollector) init() {
-	c.props = []string{"name", "remote-as", "state", "prefix-count", "updates-sent", "updates-received", "withdrawn-sent", "withdrawn-received"}
+	c.v6Props = []string{"name", "remote-as", "remote-address", "local-address", "state", "uptime", "prefix-count", "updates-sent", "updates-received", "withdrawn-sent", "withdrawn-received"}
+	c.v7Props = []string{"name", "remote.as", "remote.address", "local.address", "vrf", "established", "uptime", "prefix-count", "local.messages", "remote.messages"}
+	// updates and withdrawals are only counted by RouterOS 6, messages only
+	// by RouterOS 7
+	c.metricProps = []string{"prefix-count", "messages-sent", "messages-received", "updates-sent", "updates-received", "withdrawn-sent", "withdrawn-received"}
 
 	const prefix = "bgp"
-	labelNames := []string{"session", "asn"}
+	labelNames := []string{"session", "asn", "vrf", "local_address", "remote_address"}
 
 	c.descriptions = make(map[string]*prometheus.Desc)
-	c.descriptions["state"] = description(prefix, "up", "BGP session is established (up = 1)", labelNames)
+	c.descriptions["up"] = description(prefix, "up", "BGP session is established (up = 1)", labelNames)
+	c.descriptions["state"] = description(prefix, "state", "BGP session state (idle = 1, connect = 2, active = 3, opensent = 4, openconfirm = 5, established = 6)", labelNames)
+	c.descriptions["uptime"] = description(prefix, "uptime_seconds", "time the BGP session has been established", labelNames)
 
-	for _, p := range c.props[3:] {
+	for _, p := range c.metricProps {
 		c.descriptions[p] = descriptionForPropertyName(prefix, p, labelNames)
 	}
 }
@@ -40,65 +76,119 @@ func (c *bgpCollector) describe(ch chan<- *prometheus.Desc) {
 }
 
 func (c *bgpCollector) collect(ctx *collectorContext) error {
-	stats, err := c.fetch(ctx)
+	sessions, err := c.fetch(ctx)
 	if err != nil {
 		return err
 	}
 
-	for _, re := range stats {
-		c.collectForStat(ctx, re)
+	for _, s := range sessions {
+		c.collectForSession(ctx, s)
 	}
 
 	return nil
 }
 
-func (c *bgpCollector) fetch(ctx *collectorContext) ([]*proto.Sentence, error) {
-	reply, err := ctx.Run("/routing/bgp/peer/print", "=.proplist="+strings.Join(c.props, ","))
+// fetch returns the BGP sessions of the device with the properties named as on
+// RouterOS 6.
+func (c *bgpCollector) fetch(ctx *collectorContext) ([]map[string]string, error) {
+	major, err := ctx.majorVersion()
 	if err != nil {
 		return nil, err
 	}
 
-	return reply.Re, nil
-}
-
-func (c *bgpCollector) collectForStat(ctx *collectorContext, re *proto.Sentence) {
-	asn := re.Map["remote-as"]
-	session := re.Map["name"]
+	if major < 7 {
+		reply, err := ctx.Run("/routing/bgp/peer/print", "=.proplist="+strings.Join(c.v6Props, ","))
+		if err != nil {
+			return nil, err
+		}
 
-	for _, p := range c.props[2:] {
-		c.collectMetricForProperty(ctx, p, session, asn, re)
+		sessions := make([]map[string]string, len(reply.Re))
+		for i, re := range reply.Re {
+			sessions[i] = re.Map
+		}
+		return sessions, nil
 	}
-}
 
-func (c *bgpCollector) collectMetricForProperty(ctx *collectorContext, property, session, asn string, re *proto.Sentence) {
-	desc := c.descriptions[property]
-	v, err := c.parseValueForProperty(property, re.Map[property])
+	reply, err := ctx.Run("/routing/bgp/session/print", "=.proplist="+strings.Join(c.v7Props, ","))
 	if err != nil {
-		ctx.log.Error(
-			"error parsing bgp metric value",
-			"session", session,
-			"property", property,
-			"value", re.Map[property],
-			"err", err,
-		)
-		return
+		return nil, err
 	}
 
-	ctx.ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, session, asn)
+	sessions := make([]map[string]string, len(reply.Re))
+	for i, re := range reply.Re {
+		s := make(map[string]string, len(re.Map))
+		for k, v := range re.Map {
+			s[k] = v
+		}
+		for v6, v7 := range bgpV7Props {
+			if v, ok := re.Map[v7]; ok {
+				s[v6] = v
+			}
+		}
+		// sessions only report whether they are established, the state of
+		// the others is unknown
+		if re.Map["established"] == "true" || re.Map["established"] == "yes" {
+			s["state"] = "established"
+		}
+		sessions[i] = s
+	}
+	return sessions, nil
 }
 
-func (c *bgpCollector) parseValueForProperty(property, value string) (float64, error) {
-	if property == "state" {
-		if value == "established" {
-			return 1, nil
+func (c *bgpCollector) collectForSession(ctx *collectorContext, s map[string]string) {
+	labelValues := []string{s["name"], s["remote-as"], s["vrf"], s["local-address"], s["remote-address"]}
+
+	state := strings.ToLower(s["state"])
+	up := 0.0
+	if state == "established" {
+		up = 1
+	}
+	ctx.ch <- prometheus.MustNewConstMetric(c.descriptions["up"], prometheus.GaugeValue, up, labelValues...)
+	if v, ok := bgpStates[state]; ok {
+		ctx.ch <- prometheus.MustNewConstMetric(c.descriptions["state"], prometheus.GaugeValue, v, labelValues...)
+	}
+
+	if uptime := s["uptime"]; uptime != "" {
+		v, err := parseDuration(uptime)
+		if err != nil {
+			ctx.log.Error(
+				"error parsing bgp metric value",
+				"session", s["name"],
+				"property", "uptime",
+				"value", uptime,
+				"err", err,
+			)
+		} else {
+			ctx.ch <- prometheus.MustNewConstMetric(c.descriptions["uptime"], prometheus.GaugeValue, v, labelValues...)
 		}
+	}
+
+	for _, p := range c.metricProps {
+		c.collectMetricForProperty(ctx, p, labelValues, s)
+	}
+}
 
-		return 0, nil
+func (c *bgpCollector) collectMetricForProperty(ctx *collectorContext, property string, labelValues []string, s map[string]string) {
+	value, ok := s[property]
+	if !ok {
+		return
 	}
 
-	if value == "" {
-		return 0, nil
+	v := 0.0
+	if value != "" {
+		var err error
+		v, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			ctx.log.Error(
+				"error parsing bgp metric value",
+				"session", s["name"],
+				"property", property,
+				"value", value,
+				"err", err,
+			)
+			return
+		}
 	}
 
-	return strconv.ParseFloat(value, 64)
+	ctx.ch <- prometheus.MustNewConstMetric(c.descriptions[property], prometheus.GaugeValue, v, labelValues...)
 }
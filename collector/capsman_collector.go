@@ -13,6 +13,14 @@ type capsmanCollector struct {
 	descriptions map[string]*prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "capsman",
+		newCollector: newCapsmanCollector,
+		description:  "CAPsMAN registered clients and their signal",
+	})
+}
+
 func newCapsmanCollector() routerOSCollector {
 	c := &capsmanCollector{}
 	c.init()
@@ -5,7 +5,9 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/go-routeros/routeros/v3"
@@ -20,30 +22,54 @@ const (
 )
 
 var (
+	upDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "up"),
+		"mikrotik_exporter: whether the device could be connected to and logged into",
+		[]string{},
+		nil,
+	)
 	scrapeDurationDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "scrape", "collector_duration_seconds"),
 		"mikrotik_exporter: duration of a device collector scrape",
-		[]string{},
+		[]string{"collector"},
 		nil,
 	)
 	scrapeSuccessDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "scrape", "collector_success"),
 		"mikrotik_exporter: whether a device collector succeeded",
-		[]string{},
+		[]string{"collector"},
+		nil,
+	)
+	scrapeTimeoutDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_timeout"),
+		"mikrotik_exporter: whether a device collector was interrupted or skipped because the scrape deadline passed",
+		[]string{"collector"},
 		nil,
 	)
 )
 
 type collector struct {
-	collectors []routerOSCollector
+	// name of the module the collector was created for
+	module string
+
+	collectors []namedCollector
+	// maximum number of collectors run at the same time
+	concurrency int
 	// if nil, tls will not be used to connect to the device
 	tlsCfg *tls.Config
+	// if nil, every interface is collected
+	interfaceFilter *interfaceFilter
 
 	usernameFile string
 	passwordFile string
 
 	usernameStr string
 	passwordStr string
+
+	// if nil, a new session is dialed for every scrape
+	pool *connPool
+	// if nil, exporter metrics are not recorded
+	metrics *exporterMetrics
 }
 
 func (c *collector) credentials() (string, string, error) {
@@ -63,65 +89,213 @@ func (c *collector) credentials() (string, string, error) {
 	return c.usernameStr, c.passwordStr, nil
 }
 
-func (c *collector) collectForDevice(ctx context.Context, target string, ch chan<- prometheus.Metric) {
-	begin := time.Now()
+// hasCredentials returns whether c was configured with credentials.
+func (c *collector) hasCredentials() bool {
+	return c.usernameStr != "" || c.passwordStr != "" || c.usernameFile != "" || c.passwordFile != ""
+}
 
-	err := c.connectAndCollect(ctx, target, ch)
+func (c *collector) collectForDevice(ctx context.Context, target string, collectors []namedCollector, ch chan<- prometheus.Metric) {
+	err := c.connectAndCollect(ctx, target, collectors, ch)
 
-	duration := time.Since(begin)
-	var success float64
+	var up float64
 	if err != nil {
-		slog.Error("collector failed", "target", target, "duration", duration.Seconds(), "err", err)
-		success = 0
+		slog.Error("device scrape failed", "target", target, "err", err)
+		up = 0
 	} else {
-		slog.Debug("collector succeeded", "target", target, "duration", duration.Seconds())
-		success = 1
+		up = 1
 	}
 
-	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds())
-	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success)
+	ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, up)
 }
 
-func (c *collector) connectAndCollect(ctx context.Context, target string, ch chan<- prometheus.Metric) error {
+// connectAndCollect runs collectors against target. It only returns an error if
+// the device could not be connected to, failing collectors are reported through
+// scrapeSuccessDesc instead.
+func (c *collector) connectAndCollect(ctx context.Context, target string, collectors []namedCollector, ch chan<- prometheus.Metric) error {
 	logger := slog.With("target", target)
 
-	cl, err := c.connect(ctx, target)
+	s, err := c.connect(ctx, target)
 	if err != nil {
 		return fmt.Errorf("connect: %w", err)
 	}
-	defer cl.Close()
+	defer c.release(ctx, s)
 
 	collectorCtx := &collectorContext{
-		ch:     ch,
-		client: cl,
-		log:    logger,
+		ctx:     ctx,
+		ch:      ch,
+		session: s,
+		log:     logger,
+		version: &routerOSVersion{},
 	}
-	for _, co := range c.collectors {
-		err = co.collect(collectorCtx)
-		if err != nil {
-			return fmt.Errorf("collect: %w", err)
-		}
+	if c.interfaceFilter != nil {
+		collectorCtx.interfaces = &interfaceSelection{filter: c.interfaceFilter}
+	}
+
+	sem := make(chan struct{}, max(c.concurrency, 1))
+	var wg sync.WaitGroup
+	for _, co := range collectors {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			c.runCollector(collectorCtx, co)
+		}()
 	}
+	wg.Wait()
 
 	return nil
 }
 
-func (c *collector) connect(ctx context.Context, target string) (*routeros.Client, error) {
-	var client *routeros.Client
-	var err error
+func (c *collector) runCollector(ctx *collectorContext, co namedCollector) {
+	ctx = ctx.forCollector(c, co.name)
+	if err := ctx.ctx.Err(); err != nil {
+		ctx.log.Warn("collector skipped", "err", err)
+		ctx.ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, 0, co.name)
+		ctx.ch <- prometheus.MustNewConstMetric(scrapeTimeoutDesc, prometheus.GaugeValue, 1, co.name)
+		return
+	}
+
+	begin := time.Now()
+
+	supported, err := supportedByDevice(ctx, co.name)
+	if err == nil && !supported {
+		ctx.log.Debug("collector skipped, RouterOS version too old")
+		return
+	}
+	if err == nil {
+		err = co.collect(ctx)
+	}
+
+	duration := time.Since(begin)
+	var success, timeout float64
+	if err != nil {
+		ctx.log.Error("collector failed", "duration", duration.Seconds(), "err", err)
+		success = 0
+		if ctx.ctx.Err() != nil {
+			timeout = 1
+		}
+	} else {
+		ctx.log.Debug("collector succeeded", "duration", duration.Seconds())
+		success = 1
+	}
+
+	ctx.ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), co.name)
+	ctx.ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, co.name)
+	ctx.ch <- prometheus.MustNewConstMetric(scrapeTimeoutDesc, prometheus.GaugeValue, timeout, co.name)
+}
+
+// supportedByDevice returns whether the device runs the minimum RouterOS
+// version of the collector called name, if it has one.
+func supportedByDevice(ctx *collectorContext, name string) (bool, error) {
+	f, ok := collectorFactories[name]
+	if !ok || f.minVersion == "" {
+		return true, nil
+	}
+
+	major, minor, _ := parseVersion(f.minVersion)
+	return ctx.versionAtLeast(major, minor)
+}
+
+// connect returns a session to target, reusing a cached one if c has a pool.
+func (c *collector) connect(ctx context.Context, target string) (*session, error) {
+	if c.pool != nil {
+		return c.pool.get(ctx, c, target)
+	}
+
 	username, password, err := c.credentials()
 	if err != nil {
 		return nil, fmt.Errorf("credentials: %w", err)
 	}
 
+	return c.dial(ctx, target, username, password)
+}
+
+// release returns s to the pool, or closes it if c has no pool. Sessions used
+// past the deadline of ctx are never reused, go-routeros cancels their reader.
+func (c *collector) release(ctx context.Context, s *session) {
+	if ctx.Err() != nil {
+		s.broken.Store(true)
+	}
+	if c.pool != nil {
+		c.pool.put(s)
+		return
+	}
+
+	_ = s.client.Close()
+}
+
+// identity returns the system identity of target.
+func (c *collector) identity(ctx context.Context, target string) (string, error) {
+	s, err := c.connect(ctx, target)
+	if err != nil {
+		return "", fmt.Errorf("connect: %w", err)
+	}
+	defer c.release(ctx, s)
+
+	reply, err := s.client.RunContext(ctx, "/system/identity/print", "=.proplist=name")
+	if err != nil {
+		s.fail(err)
+		return "", err
+	}
+	if len(reply.Re) == 0 {
+		return "", fmt.Errorf("no identity returned")
+	}
+
+	return reply.Re[0].Map["name"], nil
+}
+
+func (c *collector) dial(ctx context.Context, target, username, password string) (*session, error) {
+	client, err := c.dialAndLogin(ctx, target, username, password)
+	if err != nil {
+		if c.metrics != nil {
+			c.metrics.dialFailures.WithLabelValues(c.module, dialFailureReason(err)).Inc()
+		}
+		return nil, err
+	}
+
+	return &session{
+		key:    poolKey{c: c, target: target},
+		client: client,
+		creds:  credentialsHash(username, password),
+		// tagged commands let collectors share the session, and the async
+		// loop notices when the connection dies
+		asyncErr: client.Async(),
+	}, nil
+}
+
+func (c *collector) dialAndLogin(ctx context.Context, target, username, password string) (*routeros.Client, error) {
+	var conn net.Conn
+	var err error
 	if c.tlsCfg != nil {
-		client, err = routeros.DialTLSContext(ctx, target, username, password, c.tlsCfg)
+		conn, err = (&tls.Dialer{Config: c.tlsCfg}).DialContext(ctx, "tcp", target)
 	} else {
-		client, err = routeros.DialContext(ctx, target, username, password)
+		conn, err = new(net.Dialer).DialContext(ctx, "tcp", target)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("dial: %w", err)
 	}
 
+	// the client ignores the context until it is in async mode, so the
+	// login is bounded by a connection deadline instead
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := routeros.NewClient(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("client: %w", err)
+	}
+
+	err = client.LoginContext(ctx, username, password)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("login: %w", err)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
 	return client, nil
 }
@@ -1,24 +1,62 @@
 package collector
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 
 	"github.com/go-routeros/routeros/v3"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type collectorContext struct {
-	ch     chan<- prometheus.Metric
-	client *routeros.Client
-	log    *slog.Logger
+	// bounds every command run by the collector, usually the scrape deadline
+	ctx     context.Context
+	ch      chan<- prometheus.Metric
+	session *session
+	log     *slog.Logger
+
+	// interfaces passing the interface filter of the module, nil if every
+	// interface is collected
+	interfaces *interfaceSelection
+	// version of the device, shared by the collectors of a scrape
+	version *routerOSVersion
+
+	// if nil, commands are not counted
+	commands prometheus.Counter
+}
+
+// forCollector returns a copy of c for the collector called name.
+func (c *collectorContext) forCollector(co *collector, name string) *collectorContext {
+	cc := *c
+	cc.log = c.log.With("collector", name)
+	if co.metrics != nil {
+		cc.commands = co.metrics.apiCommands.WithLabelValues(co.module, name)
+	}
+
+	return &cc
 }
 
 // assumes that the first sentence is the command
 func (c *collectorContext) Run(sentences ...string) (*routeros.Reply, error) {
-	reply, err := c.client.Run(sentences...)
+	if c.commands != nil {
+		c.commands.Inc()
+	}
+
+	reply, err := c.session.client.RunContext(c.ctx, sentences...)
 	if err != nil {
+		c.session.fail(err)
 		return nil, fmt.Errorf("%s: %w", sentences[0], err)
 	}
 	return reply, nil
 }
+
+// isNoSuchCommand returns whether err is the trap RouterOS replies with for
+// menus that do not exist, such as /ipv6 on RouterOS 6 without the ipv6
+// package.
+func isNoSuchCommand(err error) bool {
+	var deviceErr *routeros.DeviceError
+	return errors.As(err, &deviceErr) && strings.HasPrefix(deviceErr.Sentence.Map["message"], "no such command")
+}
@@ -0,0 +1,296 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mikrotik-exporter/config"
+	"mikrotik-exporter/internal/routerostest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+var routerOSVersions = []string{"v6", "v7"}
+
+func mustCollectorList(t *testing.T, f config.Features) []namedCollector {
+	t.Helper()
+
+	c, err := collectorList(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// fixtureCollector runs connectAndCollect against a routerostest.Server.
+// Collector durations are dropped as they are not deterministic, timeouts as
+// they are covered by TestCollectorDeadline.
+type fixtureCollector struct {
+	t      *testing.T
+	c      *collector
+	target string
+}
+
+// newFixtureCollector returns a fixtureCollector running cos against srv with
+// the credentials of the fixtures.
+func newFixtureCollector(t *testing.T, srv *routerostest.Server, cos ...namedCollector) *fixtureCollector {
+	return &fixtureCollector{
+		t:      t,
+		target: srv.Addr(),
+		c: &collector{
+			collectors:  cos,
+			usernameStr: "prometheus",
+			passwordStr: "changeme",
+		},
+	}
+}
+
+func (fc *fixtureCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- scrapeSuccessDesc
+	for _, co := range fc.c.collectors {
+		co.describe(ch)
+	}
+}
+
+func (fc *fixtureCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	metrics := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for m := range metrics {
+			if m.Desc() != scrapeDurationDesc && m.Desc() != scrapeTimeoutDesc {
+				ch <- m
+			}
+		}
+	}()
+
+	err := fc.c.connectAndCollect(ctx, fc.target, fc.c.collectors, metrics)
+	close(metrics)
+	<-done
+
+	if err != nil {
+		fc.t.Errorf("connectAndCollect: %v", err)
+	}
+}
+
+// formatMetrics returns all metrics collected by c in the text exposition format.
+func formatMetrics(t *testing.T, c prometheus.Collector) []byte {
+	t.Helper()
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, mf := range mfs {
+		err = enc.Encode(mf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func TestCollectors(t *testing.T) {
+	for _, version := range routerOSVersions {
+		for _, name := range collectorNames() {
+			// <name>-<variant>.yml fixtures cover devices that differ from
+			// the one of <name>.yml
+			fixtures, err := filepath.Glob(filepath.Join("testdata", version, name+"-*.yml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fixtures = append([]string{filepath.Join("testdata", version, name+".yml")}, fixtures...)
+
+			for _, fixture := range fixtures {
+				if _, err := os.Stat(fixture); errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+
+				t.Run(version+"/"+strings.TrimSuffix(filepath.Base(fixture), ".yml"), func(t *testing.T) {
+					testCollectorFixture(t, name, fixture)
+				})
+			}
+		}
+	}
+}
+
+// testCollectorFixture compares the metrics the collector called name collects
+// from the replies of fixture with its golden file.
+func testCollectorFixture(t *testing.T, name, fixture string) {
+	replies, err := routerostest.LoadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := routerostest.NewServer(t, replies)
+
+	fc := newFixtureCollector(t, srv, mustCollectorList(t, config.Features{name: true})...)
+
+	golden := strings.TrimSuffix(fixture, ".yml") + ".prom"
+	if *update {
+		err := os.WriteFile(golden, formatMetrics(t, fc), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = testutil.CollectAndCompare(fc, bytes.NewReader(want))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollectorErrorIsolation(t *testing.T) {
+	replies, err := routerostest.LoadFile(filepath.Join("testdata", "v6", "resource.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// /interface/lte/print is not in the fixture, so the server replies with a !trap.
+	srv := routerostest.NewServer(t, replies)
+
+	fc := newFixtureCollector(t, srv, mustCollectorList(t, config.Features{"lte": true, "resource": true})...)
+
+	want := `# HELP mikrotik_scrape_collector_success mikrotik_exporter: whether a device collector succeeded
+# TYPE mikrotik_scrape_collector_success gauge
+mikrotik_scrape_collector_success{collector="lte"} 0
+mikrotik_scrape_collector_success{collector="resource"} 1
+`
+	err = testutil.CollectAndCompare(fc, strings.NewReader(want), "mikrotik_scrape_collector_success")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n := testutil.CollectAndCount(fc, "mikrotik_system_cpu_load"); n != 1 {
+		t.Errorf("expected 1 mikrotik_system_cpu_load metric, got %d", n)
+	}
+}
+
+func TestConcurrentCollectors(t *testing.T) {
+	features := config.Features{
+		"dhcp":      true,
+		"firmware":  true,
+		"health":    true,
+		"interface": true,
+		"pools":     true,
+		"resource":  true,
+		"routes":    true,
+	}
+
+	const delay = 300 * time.Millisecond
+
+	replies := []routerostest.Reply{}
+	for _, name := range []string{"dhcp", "firmware", "health", "interface", "pools", "resource", "routes"} {
+		r, err := routerostest.LoadFile(filepath.Join("testdata", "v6", name+".yml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// firmware and health only finish together in less than twice the
+		// delay if they run at the same time
+		if name == "firmware" || name == "health" {
+			r[0].Delay = delay
+		}
+		replies = append(replies, r...)
+	}
+	srv := routerostest.NewServer(t, replies)
+
+	withConcurrency := func(concurrency int) *fixtureCollector {
+		fc := newFixtureCollector(t, srv, mustCollectorList(t, features)...)
+		fc.c.concurrency = concurrency
+		return fc
+	}
+
+	want := formatMetrics(t, withConcurrency(1))
+
+	begin := time.Now()
+	got := formatMetrics(t, withConcurrency(2))
+	if d := time.Since(begin); d >= 2*delay {
+		t.Errorf("collectors did not run concurrently, took %s", d)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("concurrent output differs from sequential output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCollectorDeadline(t *testing.T) {
+	replies, err := routerostest.LoadFile(filepath.Join("testdata", "v6", "conntrack.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replies[0].Delay = 10 * time.Second
+	srv := routerostest.NewServer(t, replies)
+
+	// conntrack runs before interface
+	c := newFixtureCollector(t, srv, mustCollectorList(t, config.Features{"conntrack": true, "interface": true})...).c
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	ch := make(chan prometheus.Metric)
+	reg := prometheus.NewRegistry()
+	go func() {
+		defer close(ch)
+
+		begin := time.Now()
+		err := c.connectAndCollect(ctx, srv.Addr(), c.collectors, ch)
+		if err != nil {
+			t.Errorf("connectAndCollect: %v", err)
+		}
+		if d := time.Since(begin); d > 5*time.Second {
+			t.Errorf("connectAndCollect did not honour the deadline, took %s", d)
+		}
+	}()
+
+	metrics := []prometheus.Metric{}
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+	reg.MustRegister(metricsCollector(metrics))
+
+	want := `# HELP mikrotik_scrape_collector_timeout mikrotik_exporter: whether a device collector was interrupted or skipped because the scrape deadline passed
+# TYPE mikrotik_scrape_collector_timeout gauge
+mikrotik_scrape_collector_timeout{collector="conntrack"} 1
+mikrotik_scrape_collector_timeout{collector="interface"} 1
+`
+	err = testutil.GatherAndCompare(reg, strings.NewReader(want), "mikrotik_scrape_collector_timeout")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// metricsCollector is an unchecked collector returning a fixed set of metrics.
+type metricsCollector []prometheus.Metric
+
+func (mc metricsCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (mc metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range mc {
+		ch <- m
+	}
+}
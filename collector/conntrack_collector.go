@@ -14,6 +14,14 @@ type conntrackCollector struct {
 	maxEntriesDesc   *prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "conntrack",
+		newCollector: newConntrackCollector,
+		description:  "connection tracking table size",
+	})
+}
+
 func newConntrackCollector() routerOSCollector {
 	const prefix = "conntrack"
 
@@ -0,0 +1,172 @@
+package collector
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"mikrotik-exporter/config"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// customCollector collects the values defined by a config.CustomCollector.
+type customCollector struct {
+	name   string
+	path   string
+	query  []string
+	labels []string
+	values []customValue
+	props  []string
+}
+
+type customValue struct {
+	property   string
+	desc       *prometheus.Desc
+	valueType  prometheus.ValueType
+	mapping    map[string]float64
+	conversion string
+	scale      float64
+}
+
+// customCollectorList returns the custom collectors of a module, sorted by
+// name. They are named custom_<name> to keep them apart from features, and
+// their metrics mikrotik_custom_<name>_<value> to keep them apart from the
+// metrics of the built-in collectors.
+func customCollectorList(custom map[string]config.CustomCollector) []namedCollector {
+	names := make([]string, 0, len(custom))
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c := make([]namedCollector, 0, len(names))
+	for _, name := range names {
+		c = append(c, namedCollector{"custom_" + name, newCustomCollector(name, custom[name])})
+	}
+
+	return c
+}
+
+func newCustomCollector(name string, cfg config.CustomCollector) routerOSCollector {
+	c := &customCollector{
+		name:   name,
+		path:   strings.TrimSuffix(cfg.Path, "/"),
+		query:  cfg.Query,
+		labels: cfg.Labels,
+	}
+	c.init(cfg.Values)
+	return c
+}
+
+func (c *customCollector) init(values []config.CustomValue) {
+	labelNames := make([]string, len(c.labels))
+	for i, l := range c.labels {
+		labelNames[i] = metricStringCleanup(l)
+	}
+
+	c.props = append([]string{}, c.labels...)
+	for _, v := range values {
+		name := v.Name
+		if name == "" {
+			name = v.Property
+		}
+		help := v.Help
+		if help == "" {
+			help = v.Property
+		}
+		valueType := prometheus.GaugeValue
+		if v.Type == "counter" {
+			valueType = prometheus.CounterValue
+		}
+		scale := v.Scale
+		if scale == 0 {
+			scale = 1
+		}
+
+		c.values = append(c.values, customValue{
+			property:   v.Property,
+			desc:       description("custom_"+c.name, name, help, labelNames),
+			valueType:  valueType,
+			mapping:    v.Mapping,
+			conversion: v.Conversion,
+			scale:      scale,
+		})
+		c.props = append(c.props, v.Property)
+	}
+}
+
+func (c *customCollector) describe(ch chan<- *prometheus.Desc) {
+	for _, v := range c.values {
+		ch <- v.desc
+	}
+}
+
+func (c *customCollector) collect(ctx *collectorContext) error {
+	stats, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, re := range stats {
+		c.collectForStat(ctx, re)
+	}
+
+	return nil
+}
+
+func (c *customCollector) fetch(ctx *collectorContext) ([]*proto.Sentence, error) {
+	words := []string{c.path + "/print", "=.proplist=" + strings.Join(c.props, ",")}
+	words = append(words, c.query...)
+
+	reply, err := ctx.Run(words...)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Re, nil
+}
+
+func (c *customCollector) collectForStat(ctx *collectorContext, re *proto.Sentence) {
+	labelValues := make([]string, len(c.labels))
+	for i, l := range c.labels {
+		labelValues[i] = re.Map[l]
+	}
+
+	for _, v := range c.values {
+		c.collectMetricForProperty(ctx, v, labelValues, re)
+	}
+}
+
+func (c *customCollector) collectMetricForProperty(ctx *collectorContext, v customValue, labelValues []string, re *proto.Sentence) {
+	value, ok := re.Map[v.property]
+	if !ok || value == "" {
+		return
+	}
+
+	var numericValue float64
+	var err error
+	if mapped, ok := v.mapping[value]; ok {
+		numericValue = mapped
+	} else {
+		switch v.conversion {
+		case "duration":
+			numericValue, err = parseDuration(value)
+		default:
+			numericValue, err = strconv.ParseFloat(value, 64)
+		}
+		if err != nil {
+			ctx.log.Error(
+				"error parsing custom metric value",
+				"property", v.property,
+				"value", value,
+				"err", err,
+			)
+			return
+		}
+		numericValue *= v.scale
+	}
+
+	ctx.ch <- prometheus.MustNewConstMetric(v.desc, v.valueType, numericValue, labelValues...)
+}
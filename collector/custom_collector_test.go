@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"mikrotik-exporter/config"
+	"mikrotik-exporter/internal/routerostest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCustomCollector(t *testing.T) {
+	srv := routerostest.NewServer(t, []routerostest.Reply{
+		{
+			Command: "/interface/vrrp/print",
+			Query:   []string{"?disabled=false"},
+			Re: []map[string]string{
+				{"name": "vrrp1", "interface": "bridge", "master": "true", "priority": "254", "uptime": "1d2h", "rx-byte": "2048"},
+				{"name": "vrrp2", "interface": "ether1", "master": "false", "priority": "100", "uptime": "bogus", "rx-byte": "1024"},
+				{"name": "vrrp3", "interface": "ether2"},
+			},
+		},
+	})
+
+	cos := customCollectorList(map[string]config.CustomCollector{
+		"vrrp": {
+			Path:   "/interface/vrrp",
+			Query:  []string{"?disabled=false"},
+			Labels: []string{"name", "interface"},
+			Values: []config.CustomValue{
+				{Property: "master", Help: "whether the router is the master", Mapping: map[string]float64{"true": 1, "false": 0}},
+				{Property: "priority"},
+				{Property: "uptime", Name: "uptime_seconds", Conversion: "duration"},
+				{Property: "rx-byte", Name: "rx_kilobytes_total", Type: "counter", Scale: 1.0 / 1024},
+			},
+		},
+	})
+	fc := newFixtureCollector(t, srv, cos...)
+
+	want := `# HELP mikrotik_scrape_collector_success mikrotik_exporter: whether a device collector succeeded
+# TYPE mikrotik_scrape_collector_success gauge
+mikrotik_scrape_collector_success{collector="custom_vrrp"} 1
+# HELP mikrotik_custom_vrrp_master whether the router is the master
+# TYPE mikrotik_custom_vrrp_master gauge
+mikrotik_custom_vrrp_master{interface="bridge",name="vrrp1"} 1
+mikrotik_custom_vrrp_master{interface="ether1",name="vrrp2"} 0
+# HELP mikrotik_custom_vrrp_priority priority
+# TYPE mikrotik_custom_vrrp_priority gauge
+mikrotik_custom_vrrp_priority{interface="bridge",name="vrrp1"} 254
+mikrotik_custom_vrrp_priority{interface="ether1",name="vrrp2"} 100
+# HELP mikrotik_custom_vrrp_rx_kilobytes_total rx-byte
+# TYPE mikrotik_custom_vrrp_rx_kilobytes_total counter
+mikrotik_custom_vrrp_rx_kilobytes_total{interface="bridge",name="vrrp1"} 2
+mikrotik_custom_vrrp_rx_kilobytes_total{interface="ether1",name="vrrp2"} 1
+# HELP mikrotik_custom_vrrp_uptime_seconds uptime
+# TYPE mikrotik_custom_vrrp_uptime_seconds gauge
+mikrotik_custom_vrrp_uptime_seconds{interface="bridge",name="vrrp1"} 93600
+`
+	err := testutil.CollectAndCompare(fc, strings.NewReader(want))
+	if err != nil {
+		t.Error(err)
+	}
+}
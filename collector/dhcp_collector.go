@@ -18,6 +18,14 @@ func (c *dhcpCollector) init() {
 	c.leasesActiveCountDesc = description(prefix, "leases_active_count", "number of active leases per DHCP server", labelNames)
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "dhcp",
+		newCollector: newDHCPCollector,
+		description:  "DHCP server lease counts",
+	})
+}
+
 func newDHCPCollector() routerOSCollector {
 	c := &dhcpCollector{}
 	c.init()
@@ -59,9 +67,9 @@ func (c *dhcpCollector) fetchDHCPServerNames(ctx *collectorContext) ([]string, e
 }
 
 func (c *dhcpCollector) colllectForDHCPServer(ctx *collectorContext, dhcpServer string) error {
-	reply, err := ctx.client.Run("/ip/dhcp-server/lease/print", fmt.Sprintf("?server=%s", dhcpServer), "=active=", "=count-only=")
+	reply, err := ctx.Run("/ip/dhcp-server/lease/print", fmt.Sprintf("?server=%s", dhcpServer), "=active=", "=count-only=")
 	if err != nil {
-		return fmt.Errorf("/ip/dhcp-server/lease/print server=%s: %w", dhcpServer, err)
+		return fmt.Errorf("server %s: %w", dhcpServer, err)
 	}
 	if reply.Done.Map["ret"] == "" {
 		return nil
@@ -20,6 +20,14 @@ func (c *dhcpLeaseCollector) init() {
 	c.descriptions = description("dhcp", "leases_metrics", "number of metrics", labelNames)
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "dhcpl",
+		newCollector: newDHCPLCollector,
+		description:  "DHCP server leases",
+	})
+}
+
 func newDHCPLCollector() routerOSCollector {
 	c := &dhcpLeaseCollector{}
 	c.init()
@@ -11,6 +11,14 @@ type dhcpv6Collector struct {
 	bindingCountDesc *prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "dhcpv6",
+		newCollector: newDHCPv6Collector,
+		description:  "DHCPv6 server binding counts",
+	})
+}
+
 func newDHCPv6Collector() routerOSCollector {
 	c := &dhcpv6Collector{}
 	c.init()
@@ -59,7 +67,7 @@ func (c *dhcpv6Collector) fetchDHCPServerNames(ctx *collectorContext) ([]string,
 }
 
 func (c *dhcpv6Collector) colllectForDHCPServer(ctx *collectorContext, dhcpServer string) error {
-	reply, err := ctx.client.Run("/ipv6/dhcp-server/binding/print", fmt.Sprintf("?server=%s", dhcpServer), "=count-only=")
+	reply, err := ctx.Run("/ipv6/dhcp-server/binding/print", fmt.Sprintf("?server=%s", dhcpServer), "=count-only=")
 	if err != nil {
 		ctx.log.Error(
 			"error fetching DHCPv6 binding counts",
@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/go-routeros/routeros/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// exporterMetrics are metrics about the exporter itself rather than a device.
+type exporterMetrics struct {
+	probes         *prometheus.CounterVec
+	probeDuration  *prometheus.HistogramVec
+	probesInFlight prometheus.Gauge
+	dialFailures   *prometheus.CounterVec
+	apiCommands    *prometheus.CounterVec
+}
+
+func newExporterMetrics() *exporterMetrics {
+	const subsystem = "exporter"
+
+	return &exporterMetrics{
+		probes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "probes_total",
+			Help:      "Number of probes served",
+		}, []string{"module"}),
+		probeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "probe_duration_seconds",
+			Help:      "Duration of probes",
+			Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"module"}),
+		probesInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "probes_in_flight",
+			Help:      "Number of probes currently being served",
+		}),
+		dialFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "dial_failures_total",
+			Help:      "Number of failed attempts to connect and log into a device",
+		}, []string{"module", "reason"}),
+		apiCommands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "api_commands_total",
+			Help:      "Number of API commands issued by collectors",
+		}, []string{"module", "collector"}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *exporterMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.probes.Describe(ch)
+	m.probeDuration.Describe(ch)
+	m.probesInFlight.Describe(ch)
+	m.dialFailures.Describe(ch)
+	m.apiCommands.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (m *exporterMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.probes.Collect(ch)
+	m.probeDuration.Collect(ch)
+	m.probesInFlight.Collect(ch)
+	m.dialFailures.Collect(ch)
+	m.apiCommands.Collect(ch)
+}
+
+// dialFailureReason classifies an error returned by collector.dial.
+func dialFailureReason(err error) string {
+	var (
+		deviceErr *routeros.DeviceError
+		netErr    net.Error
+		recordErr tls.RecordHeaderError
+		alertErr  tls.AlertError
+		verifyErr *tls.CertificateVerificationError
+	)
+
+	switch {
+	case errors.As(err, &deviceErr):
+		return "auth"
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr):
+		return "tls"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	default:
+		return "other"
+	}
+}
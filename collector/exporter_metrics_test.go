@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mikrotik-exporter/config"
+	"mikrotik-exporter/internal/routerostest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDialFailureReason(t *testing.T) {
+	srv := routerostest.NewServer(t, nil)
+	srv.SetCredentials("prometheus", "secret")
+
+	refused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refusedAddr := refused.Addr().String()
+	refused.Close()
+
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	go func() {
+		// hold connections open without ever replying
+		conns := []net.Conn{}
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	plainHTTP := httptest.NewServer(http.NotFoundHandler())
+	defer plainHTTP.Close()
+
+	testCases := []struct {
+		name     string
+		target   string
+		tlsCfg   *tls.Config
+		expected string
+	}{
+		{"auth", srv.Addr(), nil, "auth"},
+		{"refused", refusedAddr, nil, "refused"},
+		{"timeout", silent.Addr().String(), nil, "timeout"},
+		{"tls", plainHTTP.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true}, "tls"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := &collector{tlsCfg: testCase.tlsCfg}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			_, err := c.dial(ctx, testCase.target, "prometheus", "changeme")
+			if err == nil {
+				t.Fatal("expected an error but got nil")
+			}
+
+			if reason := dialFailureReason(err); reason != testCase.expected {
+				t.Errorf("expected %q, got %q (%v)", testCase.expected, reason, err)
+			}
+		})
+	}
+}
+
+func TestAPICommandsMetric(t *testing.T) {
+	metrics := newExporterMetrics()
+	c, srv := newPoolTestCollector(t, nil)
+	c.metrics = metrics
+	c.collectors = mustCollectorList(t, config.Features{"resource": true, "dhcp": true})
+
+	scrape(t, c, srv.Addr())
+
+	if n := testutil.ToFloat64(metrics.apiCommands.WithLabelValues("default", "resource")); n != 1 {
+		t.Errorf("expected 1 resource command, got %f", n)
+	}
+	// /ip/dhcp-server/print traps, so no lease counts are requested
+	if n := testutil.ToFloat64(metrics.apiCommands.WithLabelValues("default", "dhcp")); n != 1 {
+		t.Errorf("expected 1 dhcp command, got %f", n)
+	}
+}
@@ -0,0 +1,174 @@
+package collector
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mikrotik-exporter/config"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// firewallTables are the firewall tables collected for both IP versions.
+var firewallTables = []string{"filter", "nat", "mangle", "raw"}
+
+// firewallPositionRegex matches the rule labels of rules identified by their
+// position.
+var firewallPositionRegex = regexp.MustCompile(`^#[0-9]+$`)
+
+type firewallCollector struct {
+	cfg         config.Firewall
+	props       []string
+	bytesDesc   *prometheus.Desc
+	packetsDesc *prometheus.Desc
+}
+
+func init() {
+	registerCollector(collectorFactory{
+		name:         "firewall",
+		newCollector: newFirewallCollector,
+		description:  "packets and bytes matched by firewall rules",
+	})
+}
+
+func newFirewallCollector() routerOSCollector {
+	c := &firewallCollector{}
+	c.init(config.Firewall{})
+	return c
+}
+
+func (c *firewallCollector) init(cfg config.Firewall) {
+	c.cfg = cfg
+
+	// disabled and dynamic rules are filtered after fetching, so that the
+	// positions of the other rules are those shown by the device
+	c.props = []string{"chain", "action", "comment", "bytes", "packets", "disabled", "dynamic"}
+	if cfg.Key != "" && cfg.Key != "comment" {
+		c.props = append(c.props, cfg.Key)
+	}
+
+	// positions change when rules are reordered, a key keeps the series of a
+	// rule apart from its position. The comment is left out then, it is
+	// usually the key or changes along with it.
+	labelNames := []string{"ip_version", "table", "chain", "action", "comment", "position"}
+	if cfg.Key != "" {
+		labelNames = []string{"ip_version", "table", "chain", "action", "rule"}
+	}
+
+	const prefix = "firewall"
+	c.bytesDesc = description(prefix, "bytes", "number of bytes matched by the firewall rule", labelNames)
+	c.packetsDesc = description(prefix, "packets", "number of packets matched by the firewall rule", labelNames)
+}
+
+// configure applies the firewall config of a module.
+func (c *firewallCollector) configure(cfg config.Firewall) {
+	c.init(cfg)
+}
+
+func (c *firewallCollector) describe(ch chan<- *prometheus.Desc) {
+	ch <- c.bytesDesc
+	ch <- c.packetsDesc
+}
+
+func (c *firewallCollector) collect(ctx *collectorContext) error {
+	major, err := ctx.majorVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range firewallTables {
+		if err := c.collectForTable(ctx, "4", "ip", table); err != nil {
+			return err
+		}
+	}
+	for _, table := range firewallTables {
+		// RouterOS 6 has no IPv6 NAT
+		if table == "nat" && major < 7 {
+			continue
+		}
+		err := c.collectForTable(ctx, "6", "ipv6", table)
+		if isNoSuchCommand(err) {
+			ctx.log.Debug("no ipv6 firewall, the ipv6 package is disabled", "err", err)
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *firewallCollector) fetch(ctx *collectorContext, topic, table string) ([]*proto.Sentence, error) {
+	reply, err := ctx.Run("/"+topic+"/firewall/"+table+"/print", "=.proplist="+strings.Join(c.props, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Re, nil
+}
+
+func (c *firewallCollector) collectForTable(ctx *collectorContext, ipVersion, topic, table string) error {
+	rules, err := c.fetch(ctx, topic, table)
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]int{}
+	if c.cfg.Key != "" {
+		for _, re := range rules {
+			keys[re.Map[c.cfg.Key]]++
+		}
+	}
+
+	for i, re := range rules {
+		if (c.cfg.SkipDisabled && re.Map["disabled"] == "true") || (c.cfg.SkipDynamic && re.Map["dynamic"] == "true") {
+			continue
+		}
+
+		position := strconv.Itoa(i)
+		labelValues := []string{ipVersion, table, re.Map["chain"], re.Map["action"], re.Map["comment"], position}
+		if c.cfg.Key != "" {
+			labelValues = []string{ipVersion, table, re.Map["chain"], re.Map["action"], c.ruleLabel(re.Map[c.cfg.Key], i, keys)}
+		}
+
+		c.collectMetricForProperty(ctx, c.bytesDesc, "bytes", labelValues, re)
+		c.collectMetricForProperty(ctx, c.packetsDesc, "packets", labelValues, re)
+	}
+
+	return nil
+}
+
+// ruleLabel returns the rule label of the rule at position with key. Rules
+// without a key or sharing one with another rule of the table fall back to
+// #<position>, which keys of that form do as well, so labels never collide.
+func (c *firewallCollector) ruleLabel(key string, position int, keys map[string]int) string {
+	if key == "" || keys[key] > 1 || firewallPositionRegex.MatchString(key) {
+		return "#" + strconv.Itoa(position)
+	}
+
+	return key
+}
+
+func (c *firewallCollector) collectMetricForProperty(ctx *collectorContext, desc *prometheus.Desc, property string, labelValues []string, re *proto.Sentence) {
+	value := re.Map[property]
+	if value == "" {
+		return
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		ctx.log.Error(
+			"error parsing firewall metric value",
+			"table", labelValues[1],
+			"property", property,
+			"value", value,
+			"err", err,
+		)
+		return
+	}
+
+	ctx.ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v, labelValues...)
+}
@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"mikrotik-exporter/config"
+	"mikrotik-exporter/internal/routerostest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFirewallCollectorKey(t *testing.T) {
+	replies := []routerostest.Reply{
+		{Command: "/system/resource/print", Re: []map[string]string{{"version": "7.16.2 (stable)"}}},
+	}
+	for _, topic := range []string{"ip", "ipv6"} {
+		for _, table := range firewallTables {
+			replies = append(replies, routerostest.Reply{Command: "/" + topic + "/firewall/" + table + "/print"})
+		}
+	}
+	replies[1].Re = []map[string]string{
+		{"chain": "input", "action": "accept", "comment": "established", "packets": "512"},
+		{"chain": "input", "action": "accept", "comment": "#5", "packets": "256"},
+		{"chain": "input", "action": "accept", "comment": "ssh", "packets": "128", "disabled": "true"},
+		{"chain": "input", "action": "accept", "comment": "icmp", "packets": "64"},
+		{"chain": "input", "action": "accept", "comment": "icmp", "packets": "48"},
+		{"chain": "input", "action": "drop", "packets": "32"},
+		{"chain": "forward", "action": "fasttrack-connection", "packets": "16", "dynamic": "true"},
+	}
+	srv := routerostest.NewServer(t, replies)
+
+	co := newFirewallCollector().(*firewallCollector)
+	co.configure(config.Firewall{Key: "comment", SkipDisabled: true, SkipDynamic: true})
+
+	fc := newFixtureCollector(t, srv, namedCollector{"firewall", co})
+
+	// positions count the skipped rules, and rules without a unique key
+	// fall back to them
+	want := `# HELP mikrotik_firewall_packets number of packets matched by the firewall rule
+# TYPE mikrotik_firewall_packets counter
+mikrotik_firewall_packets{action="accept",chain="input",ip_version="4",rule="established",table="filter"} 512
+mikrotik_firewall_packets{action="accept",chain="input",ip_version="4",rule="#1",table="filter"} 256
+mikrotik_firewall_packets{action="accept",chain="input",ip_version="4",rule="#3",table="filter"} 64
+mikrotik_firewall_packets{action="accept",chain="input",ip_version="4",rule="#4",table="filter"} 48
+mikrotik_firewall_packets{action="drop",chain="input",ip_version="4",rule="#5",table="filter"} 32
+`
+	err := testutil.CollectAndCompare(fc, strings.NewReader(want), "mikrotik_firewall_packets")
+	if err != nil {
+		t.Error(err)
+	}
+}
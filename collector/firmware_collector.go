@@ -10,6 +10,14 @@ type firmwareCollector struct {
 	description *prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "firmware",
+		newCollector: newFirmwareCollector,
+		description:  "installed packages and their versions",
+	})
+}
+
 func newFirmwareCollector() routerOSCollector {
 	c := &firmwareCollector{}
 	c.init()
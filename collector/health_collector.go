@@ -12,6 +12,14 @@ type healthCollector struct {
 	descriptions map[string]*prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "health",
+		newCollector: newhealthCollector,
+		description:  "voltage, temperature and fan sensors",
+	})
+}
+
 func newhealthCollector() routerOSCollector {
 	c := &healthCollector{}
 	c.init()
@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -29,21 +30,66 @@ func descriptionForPropertyName(prefix, property string, labelNames []string) *p
 }
 
 func descriptionForPropertyNameHelpText(prefix, property string, labelNames []string, helpText string) *prometheus.Desc {
-	return prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, prefix, metricStringCleanup(property)),
-		helpText,
-		labelNames,
-		nil,
-	)
+	return newDesc(prometheus.BuildFQName(namespace, prefix, metricStringCleanup(property)), helpText, labelNames)
 }
 
 func description(prefix, name, helpText string, labelNames []string) *prometheus.Desc {
-	return prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, prefix, metricStringCleanup(name)),
-		helpText,
-		labelNames,
-		nil,
-	)
+	return newDesc(prometheus.BuildFQName(namespace, prefix, metricStringCleanup(name)), helpText, labelNames)
+}
+
+// descInfo is the metric name and the label names of a description.
+type descInfo struct {
+	name   string
+	labels []string
+}
+
+// descs records the descriptions built by the collectors. Descriptions are
+// immutable, so equal ones are shared and the records stay bounded by the
+// distinct metrics, however often collectors are created.
+var descs = struct {
+	sync.Mutex
+	byKey map[string]*prometheus.Desc
+	info  map[*prometheus.Desc]descInfo
+}{
+	byKey: map[string]*prometheus.Desc{},
+	info:  map[*prometheus.Desc]descInfo{},
+}
+
+func newDesc(name, helpText string, labelNames []string) *prometheus.Desc {
+	key := name + "\x00" + helpText + "\x00" + strings.Join(labelNames, "\x00")
+
+	descs.Lock()
+	defer descs.Unlock()
+
+	if d, ok := descs.byKey[key]; ok {
+		return d
+	}
+	d := prometheus.NewDesc(name, helpText, labelNames, nil)
+	descs.byKey[key] = d
+	descs.info[d] = descInfo{name: name, labels: append([]string(nil), labelNames...)}
+
+	return d
+}
+
+// describedDescs returns the recorded descriptions that co describes.
+func describedDescs(co routerOSCollector) []descInfo {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		co.describe(ch)
+		close(ch)
+	}()
+
+	infos := []descInfo{}
+	for d := range ch {
+		descs.Lock()
+		info, ok := descs.info[d]
+		descs.Unlock()
+		if ok {
+			infos = append(infos, info)
+		}
+	}
+
+	return infos
 }
 
 func splitStringToFloats(metric string) (float64, float64, error) {
@@ -62,6 +108,24 @@ func splitStringToFloats(metric string) (float64, float64, error) {
 	return m1, m2, nil
 }
 
+// splitPairToFloats parses the "upload/download" pairs returned by simple
+// queues, such as "123/456".
+func splitPairToFloats(metric string) (float64, float64, error) {
+	s1, s2, ok := strings.Cut(metric, "/")
+	if !ok {
+		return math.NaN(), math.NaN(), fmt.Errorf("invalid pair %q", metric)
+	}
+	m1, err := strconv.ParseFloat(s1, 64)
+	if err != nil {
+		return math.NaN(), math.NaN(), err
+	}
+	m2, err := strconv.ParseFloat(s2, 64)
+	if err != nil {
+		return math.NaN(), math.NaN(), err
+	}
+	return m1, m2, nil
+}
+
 func parseDuration(duration string) (float64, error) {
 	var u time.Duration
 
@@ -85,6 +85,22 @@ func TestSplitStringToFloats(t *testing.T) {
 	}
 }
 
+func TestSplitPairToFloats(t *testing.T) {
+	f1, f2, err := splitPairToFloats("123/4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f1 != 123 || f2 != 4567 {
+		t.Errorf("expected 123 and 4567, got %f and %f", f1, f2)
+	}
+
+	for _, input := range []string{"", "123", "123/", "a/1"} {
+		if _, _, err := splitPairToFloats(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
 func TestParseDuration(t *testing.T) {
 	testCases := []struct {
 		input    string
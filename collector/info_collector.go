@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type infoCollector struct {
+	routerboardProps []string
+	resourceProps    []string
+	description      *prometheus.Desc
+	// if false, the identity label is left out because the module adds it to
+	// every metric
+	identityLabel bool
+}
+
+func init() {
+	registerCollector(collectorFactory{
+		name:           "info",
+		newCollector:   newInfoCollector,
+		description:    "device identity, model, serial number and firmware",
+		defaultEnabled: true,
+	})
+}
+
+func newInfoCollector() routerOSCollector {
+	c := &infoCollector{}
+	c.init()
+	return c
+}
+
+func (c *infoCollector) init() {
+	c.routerboardProps = []string{"model", "serial-number", "firmware-type", "current-firmware", "upgrade-firmware"}
+	c.resourceProps = []string{"architecture-name", "platform", "board-name", "version"}
+
+	c.identityLabel = true
+	c.initDescription()
+}
+
+func (c *infoCollector) initDescription() {
+	labelNames := []string{"model", "serial_number", "firmware_type", "current_firmware", "upgrade_firmware", "architecture", "platform", "board_name", "version"}
+	if c.identityLabel {
+		labelNames = append([]string{"identity"}, labelNames...)
+	}
+	c.description = description("device", "info", "device identity, hardware and software, always 1", labelNames)
+}
+
+// withoutIdentity removes the identity label from the metric.
+func (c *infoCollector) withoutIdentity() {
+	c.identityLabel = false
+	c.initDescription()
+}
+
+func (c *infoCollector) describe(ch chan<- *prometheus.Desc) {
+	ch <- c.description
+}
+
+func (c *infoCollector) collect(ctx *collectorContext) error {
+	routerboard, err := c.fetch(ctx, "/system/routerboard/print", c.routerboardProps)
+	if err != nil {
+		return err
+	}
+	resource, err := c.fetch(ctx, "/system/resource/print", c.resourceProps)
+	if err != nil {
+		return err
+	}
+
+	// CHR and x86 devices have no routerboard, their model and firmware are empty
+	labelValues := []string{
+		routerboard["model"],
+		routerboard["serial-number"],
+		routerboard["firmware-type"],
+		routerboard["current-firmware"],
+		routerboard["upgrade-firmware"],
+		resource["architecture-name"],
+		resource["platform"],
+		resource["board-name"],
+		resource["version"],
+	}
+	if c.identityLabel {
+		identity, err := c.fetch(ctx, "/system/identity/print", []string{"name"})
+		if err != nil {
+			return err
+		}
+		labelValues = append([]string{identity["name"]}, labelValues...)
+	}
+
+	ctx.ch <- prometheus.MustNewConstMetric(c.description, prometheus.GaugeValue, 1, labelValues...)
+
+	return nil
+}
+
+// fetch returns props of the single item printed by command.
+func (c *infoCollector) fetch(ctx *collectorContext, command string, props []string) (map[string]string, error) {
+	reply, err := ctx.Run(command, "=.proplist="+strings.Join(props, ","))
+	if err != nil {
+		return nil, err
+	}
+	if len(reply.Re) == 0 {
+		return map[string]string{}, nil
+	}
+
+	return reply.Re[0].Map, nil
+}
@@ -13,6 +13,15 @@ type interfaceCollector struct {
 	descriptions map[string]*prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:           "interface",
+		newCollector:   newInterfaceCollector,
+		description:    "interface traffic, errors and drops",
+		defaultEnabled: true,
+	})
+}
+
 func newInterfaceCollector() routerOSCollector {
 	c := &interfaceCollector{}
 	c.init()
@@ -41,6 +50,9 @@ func (c *interfaceCollector) collect(ctx *collectorContext) error {
 	}
 
 	for _, re := range stats {
+		if !ctx.interfaces.matches(re.Map) {
+			continue
+		}
 		c.collectForStat(ctx, re)
 	}
 
@@ -0,0 +1,161 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"mikrotik-exporter/config"
+)
+
+// interfaceFilter selects the interfaces collected by the interface, monitor,
+// optics and poe collectors.
+type interfaceFilter struct {
+	include        *regexp.Regexp
+	exclude        *regexp.Regexp
+	types          map[string]bool
+	excludeTypes   map[string]bool
+	running        *bool
+	disabled       *bool
+	comment        *regexp.Regexp
+	excludeComment *regexp.Regexp
+}
+
+// interfaceFilterProps are the /interface properties the filter looks at.
+var interfaceFilterProps = []string{"name", "type", "running", "disabled", "comment"}
+
+// newInterfaceFilter returns the filter configured by c, or nil if c selects
+// every interface.
+func newInterfaceFilter(c config.InterfaceFilter) (*interfaceFilter, error) {
+	f := &interfaceFilter{
+		types:        make(map[string]bool, len(c.Types)),
+		excludeTypes: make(map[string]bool, len(c.ExcludeTypes)),
+		running:      c.Running,
+		disabled:     c.Disabled,
+	}
+
+	for _, r := range []struct {
+		name  string
+		value string
+		re    **regexp.Regexp
+	}{
+		{"include", c.Include, &f.include},
+		{"exclude", c.Exclude, &f.exclude},
+		{"comment", c.Comment, &f.comment},
+		{"exclude_comment", c.ExcludeComment, &f.excludeComment},
+	} {
+		if r.value == "" {
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + r.value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("interfaces %s: %w", r.name, err)
+		}
+		*r.re = re
+	}
+	for _, t := range c.Types {
+		f.types[t] = true
+	}
+	for _, t := range c.ExcludeTypes {
+		f.excludeTypes[t] = true
+	}
+
+	if f.include == nil && f.exclude == nil && f.comment == nil && f.excludeComment == nil &&
+		len(f.types) == 0 && len(f.excludeTypes) == 0 && f.running == nil && f.disabled == nil {
+		return nil, nil
+	}
+
+	return f, nil
+}
+
+// matches returns whether the interface with the /interface properties iface
+// passes f.
+func (f *interfaceFilter) matches(iface map[string]string) bool {
+	name := iface["name"]
+	if f.include != nil && !f.include.MatchString(name) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(name) {
+		return false
+	}
+
+	if len(f.types) > 0 && !f.types[iface["type"]] {
+		return false
+	}
+	if f.excludeTypes[iface["type"]] {
+		return false
+	}
+
+	if f.running != nil && iface["running"] != strconv.FormatBool(*f.running) {
+		return false
+	}
+	if f.disabled != nil && iface["disabled"] != strconv.FormatBool(*f.disabled) {
+		return false
+	}
+
+	comment := iface["comment"]
+	if f.comment != nil && !f.comment.MatchString(comment) {
+		return false
+	}
+	if f.excludeComment != nil && f.excludeComment.MatchString(comment) {
+		return false
+	}
+
+	return true
+}
+
+// interfaceSelection holds the names of the interfaces passing a filter for
+// one scrape. They are fetched once by the first collector asking for them.
+type interfaceSelection struct {
+	filter *interfaceFilter
+
+	once  sync.Once
+	names map[string]bool
+	err   error
+}
+
+// matches returns whether the interface with the /interface properties iface
+// passes the filter of s. A nil s matches every interface.
+func (s *interfaceSelection) matches(iface map[string]string) bool {
+	return s == nil || s.filter == nil || s.filter.matches(iface)
+}
+
+func (s *interfaceSelection) load(ctx *collectorContext) {
+	reply, err := ctx.Run("/interface/print", "=.proplist="+strings.Join(interfaceFilterProps, ","))
+	if err != nil {
+		s.err = err
+		return
+	}
+
+	s.names = make(map[string]bool, len(reply.Re))
+	for _, re := range reply.Re {
+		if s.filter.matches(re.Map) {
+			s.names[re.Map["name"]] = true
+		}
+	}
+}
+
+// selectInterfaces returns the names that pass the interface filter of the
+// module, in their original order.
+func (c *collectorContext) selectInterfaces(names []string) ([]string, error) {
+	s := c.interfaces
+	if s == nil || s.filter == nil {
+		return names, nil
+	}
+
+	s.once.Do(func() { s.load(c) })
+	if s.err != nil {
+		return nil, fmt.Errorf("interface filter: %w", s.err)
+	}
+
+	selected := make([]string, 0, len(names))
+	for _, name := range names {
+		if s.names[name] {
+			selected = append(selected, name)
+		}
+	}
+
+	return selected, nil
+}
@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mikrotik-exporter/config"
+	"mikrotik-exporter/internal/routerostest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInterfaceFilter(t *testing.T) {
+	yes, no := true, false
+	ether1 := map[string]string{"name": "ether1", "type": "ether", "running": "true", "disabled": "false", "comment": "uplink"}
+	vlan := map[string]string{"name": "vlan100", "type": "vlan", "running": "true", "disabled": "false"}
+	pppoe := map[string]string{"name": "<pppoe-user1>", "type": "pppoe-in", "running": "true", "disabled": "false"}
+	down := map[string]string{"name": "ether2", "type": "ether", "running": "false", "disabled": "true", "comment": "spare"}
+
+	testCases := []struct {
+		name     string
+		filter   config.InterfaceFilter
+		expected []string
+	}{
+		{"include", config.InterfaceFilter{Include: "ether.*"}, []string{"ether1", "ether2"}},
+		{"include is anchored", config.InterfaceFilter{Include: "ether"}, []string{}},
+		{"exclude", config.InterfaceFilter{Exclude: "vlan.*|<.*>"}, []string{"ether1", "ether2"}},
+		{"types", config.InterfaceFilter{Types: []string{"vlan", "pppoe-in"}}, []string{"vlan100", "<pppoe-user1>"}},
+		{"exclude types", config.InterfaceFilter{ExcludeTypes: []string{"pppoe-in"}}, []string{"ether1", "vlan100", "ether2"}},
+		{"running", config.InterfaceFilter{Running: &yes}, []string{"ether1", "vlan100", "<pppoe-user1>"}},
+		{"disabled", config.InterfaceFilter{Disabled: &no, Types: []string{"ether"}}, []string{"ether1"}},
+		{"comment", config.InterfaceFilter{Comment: "up.*"}, []string{"ether1"}},
+		{"exclude comment", config.InterfaceFilter{ExcludeComment: "spare"}, []string{"ether1", "vlan100", "<pppoe-user1>"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			f, err := newInterfaceFilter(testCase.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			matched := []string{}
+			for _, iface := range []map[string]string{ether1, vlan, pppoe, down} {
+				if f.matches(iface) {
+					matched = append(matched, iface["name"])
+				}
+			}
+			if strings.Join(matched, ",") != strings.Join(testCase.expected, ",") {
+				t.Errorf("expected %v, got %v", testCase.expected, matched)
+			}
+		})
+	}
+
+	if f, err := newInterfaceFilter(config.InterfaceFilter{}); f != nil || err != nil {
+		t.Errorf("expected no filter, got %v, %v", f, err)
+	}
+}
+
+func TestInterfaceFilterCollectors(t *testing.T) {
+	replies, err := routerostest.LoadFile(filepath.Join("testdata", "v6", "interface.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replies = append(replies,
+		routerostest.Reply{
+			Command: "/interface/ethernet/print",
+			Re:      []map[string]string{{"name": "ether1"}, {"name": "ether2"}, {"name": "sfp-sfpplus1"}},
+		},
+		routerostest.Reply{
+			Command: "/interface/ethernet/monitor",
+			Args:    map[string]string{"numbers": "ether1"},
+			Re:      []map[string]string{{"name": "ether1", "status": "link-ok", "rate": "1Gbps", "full-duplex": "true"}},
+		},
+	)
+	srv := routerostest.NewServer(t, replies)
+
+	running := true
+	filter, err := newInterfaceFilter(config.InterfaceFilter{Types: []string{"ether"}, Running: &running})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc := newFixtureCollector(t, srv, mustCollectorList(t, config.Features{"interface": true, "monitor": true})...)
+	fc.c.interfaceFilter = filter
+
+	want := `# HELP mikrotik_monitor_status status
+# TYPE mikrotik_monitor_status gauge
+mikrotik_monitor_status{interface="ether1"} 1
+# HELP mikrotik_scrape_collector_success mikrotik_exporter: whether a device collector succeeded
+# TYPE mikrotik_scrape_collector_success gauge
+mikrotik_scrape_collector_success{collector="interface"} 1
+mikrotik_scrape_collector_success{collector="monitor"} 1
+`
+	err = testutil.CollectAndCompare(fc, strings.NewReader(want), "mikrotik_monitor_status", "mikrotik_scrape_collector_success")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n := testutil.CollectAndCount(fc, "mikrotik_interface_rx_byte"); n != 1 {
+		t.Errorf("expected 1 mikrotik_interface_rx_byte metric, got %d", n)
+	}
+}
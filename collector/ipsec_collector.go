@@ -13,6 +13,14 @@ type ipsecCollector struct {
 	descriptions map[string]*prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "ipsec",
+		newCollector: newIpsecCollector,
+		description:  "IPsec policies and their traffic",
+	})
+}
+
 func newIpsecCollector() routerOSCollector {
 	c := &ipsecCollector{}
 	c.init()
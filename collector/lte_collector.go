@@ -14,6 +14,14 @@ type lteCollector struct {
 	descriptions map[string]*prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "lte",
+		newCollector: newLteCollector,
+		description:  "LTE signal quality",
+	})
+}
+
 func newLteCollector() routerOSCollector {
 	c := &lteCollector{}
 	c.init()
@@ -66,7 +74,7 @@ func (c *lteCollector) fetchInterfaceNames(ctx *collectorContext) ([]string, err
 }
 
 func (c *lteCollector) collectForInterface(ctx *collectorContext, iface string) error {
-	reply, err := ctx.client.Run("/interface/lte/info", fmt.Sprintf("=number=%s", iface), "=once=", "=.proplist="+strings.Join(c.props, ","))
+	reply, err := ctx.Run("/interface/lte/info", fmt.Sprintf("=number=%s", iface), "=once=", "=.proplist="+strings.Join(c.props, ","))
 	if err != nil {
 		ctx.log.Error(
 			"error fetching interface statistics",
@@ -0,0 +1,403 @@
+package collector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"mikrotik-exporter/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultMNDPListen = ":5678"
+	defaultMNDPPort   = 8728
+	defaultMNDPExpire = 5 * time.Minute
+)
+
+// MNDP TLV types
+const (
+	mndpTypeMAC        = 1
+	mndpTypeIdentity   = 5
+	mndpTypeVersion    = 7
+	mndpTypePlatform   = 8
+	mndpTypeSoftwareID = 11
+	mndpTypeBoard      = 12
+	mndpTypeIPv4       = 17
+)
+
+var mndpLastSeenDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "exporter", "mndp_device_last_seen_timestamp_seconds"),
+	"mikrotik_exporter: time a device discovered through MNDP was last seen",
+	[]string{"identity", "mac", "address", "board", "platform", "version"},
+	nil,
+)
+
+// mndpPacket is a decoded MNDP announcement.
+type mndpPacket struct {
+	mac        net.HardwareAddr
+	identity   string
+	version    string
+	platform   string
+	board      string
+	softwareID string
+	ipv4       netip.Addr
+}
+
+// decodeMNDP decodes an MNDP announcement. It consists of a four byte header
+// followed by type-length-value fields.
+func decodeMNDP(b []byte) (mndpPacket, error) {
+	p := mndpPacket{}
+	if len(b) < 4 {
+		return p, errors.New("short packet")
+	}
+	b = b[4:]
+
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return p, errors.New("truncated field header")
+		}
+		typ := binary.BigEndian.Uint16(b[0:2])
+		l := int(binary.BigEndian.Uint16(b[2:4]))
+		if len(b) < 4+l {
+			return p, fmt.Errorf("truncated field %d", typ)
+		}
+		v := b[4 : 4+l]
+		b = b[4+l:]
+
+		switch typ {
+		case mndpTypeMAC:
+			if l == 6 {
+				p.mac = net.HardwareAddr(append([]byte{}, v...))
+			}
+		case mndpTypeIdentity:
+			p.identity = string(v)
+		case mndpTypeVersion:
+			p.version = string(v)
+		case mndpTypePlatform:
+			p.platform = string(v)
+		case mndpTypeBoard:
+			p.board = string(v)
+		case mndpTypeSoftwareID:
+			p.softwareID = string(v)
+		case mndpTypeIPv4:
+			if l == 4 {
+				p.ipv4 = netip.AddrFrom4([4]byte(v))
+			}
+		}
+	}
+
+	if p.mac == nil {
+		return p, errors.New("no mac address")
+	}
+
+	return p, nil
+}
+
+// mndpDevice is a device in the MNDP inventory.
+type mndpDevice struct {
+	mac      string
+	identity string
+	address  netip.Addr
+	board    string
+	platform string
+	version  string
+	lastSeen time.Time
+}
+
+// mndpInventory holds the devices seen by an MNDP listener. Devices sending
+// from several interfaces are kept once, keyed by their software ID.
+type mndpInventory struct {
+	expire time.Duration
+
+	mu      sync.Mutex
+	devices map[string]mndpDevice
+}
+
+func newMNDPInventory(expire time.Duration) *mndpInventory {
+	return &mndpInventory{
+		expire:  expire,
+		devices: map[string]mndpDevice{},
+	}
+}
+
+// update records p, received from src at now. Devices are probed at the
+// source address of their announcements. Announcements claiming another IPv4
+// address are rejected, so that a host cannot point the name of a device or a
+// subnet rule at an address it does not send from.
+func (inv *mndpInventory) update(p mndpPacket, src netip.Addr, now time.Time) error {
+	addr := src.Unmap()
+	if p.ipv4.IsValid() && !p.ipv4.IsUnspecified() && p.ipv4 != addr {
+		return fmt.Errorf("announced address %s differs from source address %s", p.ipv4, addr)
+	}
+
+	key := p.softwareID
+	if key == "" {
+		key = p.mac.String()
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.devices[key] = mndpDevice{
+		mac:      p.mac.String(),
+		identity: p.identity,
+		address:  addr,
+		board:    p.board,
+		platform: p.platform,
+		version:  p.version,
+		lastSeen: now,
+	}
+
+	return nil
+}
+
+// list returns the devices seen within the expiry time of now, sorted by
+// identity and MAC address. Expired devices are forgotten.
+func (inv *mndpInventory) list(now time.Time) []mndpDevice {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	devices := make([]mndpDevice, 0, len(inv.devices))
+	for key, d := range inv.devices {
+		if now.Sub(d.lastSeen) > inv.expire {
+			delete(inv.devices, key)
+			continue
+		}
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].identity != devices[j].identity {
+			return devices[i].identity < devices[j].identity
+		}
+		return devices[i].mac < devices[j].mac
+	})
+
+	return devices
+}
+
+// mndpListener receives MNDP announcements into an inventory.
+type mndpListener struct {
+	listen string
+	conn   net.PacketConn
+	inv    *mndpInventory
+}
+
+func listenMNDP(listen string, expire time.Duration) (*mndpListener, error) {
+	conn, err := net.ListenPacket("udp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("mndp: %w", err)
+	}
+
+	l := &mndpListener{
+		listen: listen,
+		conn:   conn,
+		inv:    newMNDPInventory(expire),
+	}
+	go l.serve()
+
+	return l, nil
+}
+
+func (l *mndpListener) serve() {
+	b := make([]byte, 1500)
+	for {
+		n, addr, err := l.conn.ReadFrom(b)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("mndp listener stopped", "err", err)
+			}
+			return
+		}
+
+		p, err := decodeMNDP(b[:n])
+		if err != nil {
+			slog.Debug("invalid mndp packet", "src", addr, "err", err)
+			continue
+		}
+
+		src, _ := netip.AddrFromSlice(addr.(*net.UDPAddr).IP)
+		if err := l.inv.update(p, src, time.Now()); err != nil {
+			slog.Debug("invalid mndp packet", "src", addr, "err", err)
+		}
+	}
+}
+
+func (l *mndpListener) close() {
+	_ = l.conn.Close()
+}
+
+// mndpRule maps discovered devices to a module.
+type mndpRule struct {
+	module   string
+	board    string
+	identity *regexp.Regexp
+	subnet   netip.Prefix
+	labels   prometheus.Labels
+}
+
+func newMNDPRules(rules []config.MNDPRule) ([]mndpRule, error) {
+	compiled := make([]mndpRule, 0, len(rules))
+
+	for i, r := range rules {
+		rule := mndpRule{
+			module: r.Module,
+			board:  r.Board,
+			labels: r.Labels,
+		}
+		if r.Identity != "" {
+			re, err := regexp.Compile("^(?:" + r.Identity + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("mndp rule %d: %w", i, err)
+			}
+			rule.identity = re
+		}
+		if r.Subnet != "" {
+			prefix, err := netip.ParsePrefix(r.Subnet)
+			if err != nil {
+				return nil, fmt.Errorf("mndp rule %d: %w", i, err)
+			}
+			rule.subnet = prefix.Masked()
+		} else {
+			// announcements are not authenticated, any host on the segment
+			// can claim to be a device and gets a login attempt
+			slog.Warn("mndp rule without subnet, any host announcing itself receives a login with the credentials of its module", "rule", i, "module", r.Module)
+		}
+		compiled = append(compiled, rule)
+	}
+
+	return compiled, nil
+}
+
+func (r mndpRule) matches(d mndpDevice) bool {
+	if r.board != "" && r.board != d.board {
+		return false
+	}
+	if r.identity != nil && !r.identity.MatchString(d.identity) {
+		return false
+	}
+	if r.subnet.IsValid() && !r.subnet.Contains(d.address) {
+		return false
+	}
+
+	return true
+}
+
+// mndpDiscovery publishes the devices of an MNDP listener as targets.
+type mndpDiscovery struct {
+	l     *mndpListener
+	port  int
+	rules []mndpRule
+}
+
+// newMNDPDiscovery returns the MNDP discovery configured by c. The listener of
+// current is reused if it listens on the same address.
+func newMNDPDiscovery(c *config.MNDP, current *mndpDiscovery) (*mndpDiscovery, error) {
+	rules, err := newMNDPRules(c.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	listen := c.Listen
+	if listen == "" {
+		listen = defaultMNDPListen
+	}
+	port := c.Port
+	if port == 0 {
+		port = defaultMNDPPort
+	}
+	expire := time.Duration(c.Expire)
+	if expire == 0 {
+		expire = defaultMNDPExpire
+	}
+
+	var l *mndpListener
+	if current != nil && current.l.listen == listen {
+		l = current.l
+		l.inv.mu.Lock()
+		l.inv.expire = expire
+		l.inv.mu.Unlock()
+	} else {
+		l, err = listenMNDP(listen, expire)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &mndpDiscovery{
+		l:     l,
+		port:  port,
+		rules: rules,
+	}, nil
+}
+
+// targets returns the discovered devices matching a rule, named by their
+// identity. Devices sharing an identity are told apart by their MAC address.
+func (m *mndpDiscovery) targets(modules map[string]proberModule, now time.Time) map[string]proberTarget {
+	devices := m.l.inv.list(now)
+
+	identities := map[string]int{}
+	for _, d := range devices {
+		identities[d.identity]++
+	}
+
+	targets := map[string]proberTarget{}
+	for _, d := range devices {
+		for _, r := range m.rules {
+			if !r.matches(d) {
+				continue
+			}
+
+			module, ok := modules[r.module]
+			if !ok {
+				break
+			}
+
+			name := d.identity
+			switch {
+			case name == "" || isAddress(name):
+				// identities looking like addresses would capture
+				// probes by address
+				name = d.mac
+			case identities[name] > 1:
+				name += "@" + d.mac
+			}
+			targets[name] = proberTarget{
+				address: net.JoinHostPort(d.address.String(), strconv.Itoa(m.port)),
+				module:  r.module,
+				c:       module.c,
+				labels:  r.labels,
+			}
+			break
+		}
+	}
+
+	return targets
+}
+
+// isAddress returns whether name is an IP address or a host:port.
+func isAddress(name string) bool {
+	if _, err := netip.ParseAddr(name); err == nil {
+		return true
+	}
+	_, _, err := net.SplitHostPort(name)
+	return err == nil
+}
+
+// collect sends the last seen time of every device in the inventory.
+func (m *mndpDiscovery) collect(ch chan<- prometheus.Metric) {
+	for _, d := range m.l.inv.list(time.Now()) {
+		ch <- prometheus.MustNewConstMetric(mndpLastSeenDesc, prometheus.GaugeValue,
+			float64(d.lastSeen.UnixNano())/1e9,
+			d.identity, d.mac, d.address.String(), d.board, d.platform, d.version)
+	}
+}
@@ -0,0 +1,255 @@
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"mikrotik-exporter/config"
+)
+
+type mndpField struct {
+	typ   uint16
+	value []byte
+}
+
+func encodeMNDP(fields ...mndpField) []byte {
+	b := []byte{0, 0, 0, 1}
+	for _, f := range fields {
+		b = binary.BigEndian.AppendUint16(b, f.typ)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(f.value)))
+		b = append(b, f.value...)
+	}
+
+	return b
+}
+
+func mndpAnnouncement(mac, identity, board string, ipv4 string) []byte {
+	hw, _ := net.ParseMAC(mac)
+	fields := []mndpField{
+		{mndpTypeMAC, hw},
+		{mndpTypeIdentity, []byte(identity)},
+		{mndpTypeVersion, []byte("7.16.2 (stable)")},
+		{mndpTypePlatform, []byte("MikroTik")},
+		{10, binary.LittleEndian.AppendUint32(nil, 3600)},
+		{mndpTypeSoftwareID, []byte("ID-" + mac)},
+		{mndpTypeBoard, []byte(board)},
+	}
+	if ipv4 != "" {
+		fields = append(fields, mndpField{mndpTypeIPv4, netip.MustParseAddr(ipv4).AsSlice()})
+	}
+
+	return encodeMNDP(fields...)
+}
+
+func TestDecodeMNDP(t *testing.T) {
+	p, err := decodeMNDP(mndpAnnouncement("48:8f:5a:01:02:03", "branch-rtr-1", "RB5009UG+S+", "192.0.2.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.mac.String() != "48:8f:5a:01:02:03" || p.identity != "branch-rtr-1" || p.board != "RB5009UG+S+" ||
+		p.version != "7.16.2 (stable)" || p.platform != "MikroTik" || p.ipv4 != netip.MustParseAddr("192.0.2.1") {
+		t.Errorf("unexpected packet: %+v", p)
+	}
+
+	for _, b := range [][]byte{
+		{0, 0},
+		encodeMNDP(mndpField{mndpTypeIdentity, []byte("no-mac")}),
+		mndpAnnouncement("48:8f:5a:01:02:03", "branch-rtr-1", "RB5009UG+S+", "")[:10],
+	} {
+		if _, err := decodeMNDP(b); err == nil {
+			t.Errorf("expected an error decoding %x", b)
+		}
+	}
+}
+
+func TestMNDPDiscoveryTargets(t *testing.T) {
+	rules, err := newMNDPRules([]config.MNDPRule{
+		{Module: "lte", Board: "RBLtAP-2HnD"},
+		{Module: "default", Identity: "branch-.*", Subnet: "192.0.2.0/24", Labels: map[string]string{"role": "branch"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1000, 0)
+	inv := newMNDPInventory(time.Minute)
+	for _, a := range []struct {
+		packet []byte
+		src    string
+		valid  bool
+	}{
+		{mndpAnnouncement("48:8f:5a:00:00:01", "branch-rtr-1", "RB5009UG+S+", "192.0.2.1"), "192.0.2.1", true},
+		{mndpAnnouncement("48:8f:5a:00:00:02", "lte-1", "RBLtAP-2HnD", ""), "198.51.100.1", true},
+		{mndpAnnouncement("48:8f:5a:00:00:03", "core-rtr-1", "CCR2004-16G-2S+", "192.0.2.3"), "192.0.2.3", true},
+		// subnets are matched against the source address
+		{mndpAnnouncement("48:8f:5a:00:00:04", "branch-rtr-2", "RB5009UG+S+", ""), "198.51.100.4", true},
+		// a claimed address differing from the source is rejected
+		{mndpAnnouncement("48:8f:5a:00:00:09", "branch-rtr-3", "RB5009UG+S+", "192.0.2.9"), "198.51.100.9", false},
+		{mndpAnnouncement("48:8f:5a:00:00:05", "branch-dup", "RB5009UG+S+", "192.0.2.5"), "192.0.2.5", true},
+		{mndpAnnouncement("48:8f:5a:00:00:06", "branch-dup", "RB5009UG+S+", "192.0.2.6"), "192.0.2.6", true},
+		// identities looking like addresses are replaced by the MAC address
+		{mndpAnnouncement("48:8f:5a:00:00:08", "branch-rtr-8:8728", "RB5009UG+S+", ""), "192.0.2.8", true},
+	} {
+		p, err := decodeMNDP(a.packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = inv.update(p, netip.MustParseAddr(a.src), now)
+		if a.valid && err != nil {
+			t.Errorf("expected no error but got: %v", err)
+		} else if !a.valid && err == nil {
+			t.Errorf("expected an error for %s but got nil", a.src)
+		}
+	}
+
+	expired, _ := decodeMNDP(mndpAnnouncement("48:8f:5a:00:00:07", "branch-old", "RB5009UG+S+", "192.0.2.7"))
+	_ = inv.update(expired, netip.MustParseAddr("192.0.2.7"), now.Add(-2*time.Minute))
+
+	d := &mndpDiscovery{
+		l:     &mndpListener{inv: inv},
+		port:  8728,
+		rules: rules,
+	}
+	modules := map[string]proberModule{
+		"default": {c: &collector{module: "default"}},
+		"lte":     {c: &collector{module: "lte"}},
+	}
+	targets := d.targets(modules, now)
+
+	expected := map[string]string{
+		"branch-rtr-1":                 "default 192.0.2.1:8728",
+		"lte-1":                        "lte 198.51.100.1:8728",
+		"branch-dup@48:8f:5a:00:00:05": "default 192.0.2.5:8728",
+		"branch-dup@48:8f:5a:00:00:06": "default 192.0.2.6:8728",
+		"48:8f:5a:00:00:08":            "default 192.0.2.8:8728",
+	}
+	if len(targets) != len(expected) {
+		t.Errorf("expected %d targets, got %d: %v", len(expected), len(targets), targets)
+	}
+	for name, e := range expected {
+		target, ok := targets[name]
+		if !ok {
+			t.Errorf("target %s not found", name)
+			continue
+		}
+		if got := target.module + " " + target.address; got != e {
+			t.Errorf("target %s: expected %q, got %q", name, e, got)
+		}
+		if target.c != modules[target.module].c {
+			t.Errorf("target %s: not using the collector of its module", name)
+		}
+	}
+	if targets["branch-rtr-1"].labels["role"] != "branch" {
+		t.Errorf("rule labels were not added")
+	}
+}
+
+func TestProberMNDPShadowing(t *testing.T) {
+	rules, err := newMNDPRules([]config.MNDPRule{{Module: "default"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv := newMNDPInventory(time.Minute)
+	for i, identity := range []string{"core-rtr-1", "branches", "branch-rtr-1"} {
+		src := netip.AddrFrom4([4]byte{192, 0, 2, byte(i + 1)})
+		p, err := decodeMNDP(mndpAnnouncement(fmt.Sprintf("48:8f:5a:00:00:0%d", i+1), identity, "RB5009UG+S+", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := inv.update(p, src, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := &Prober{
+		modules: map[string]proberModule{"default": {c: &collector{module: "default"}}},
+		targets: map[string]proberTarget{"core-rtr-1": {address: "192.0.2.100:8728", module: "default"}},
+		groups:  map[string]*srvGroup{"branches": {module: "default"}},
+		mndp:    &mndpDiscovery{l: &mndpListener{inv: inv}, port: 8728, rules: rules},
+	}
+
+	// discovered names never shadow configured targets and groups
+	if target, _ := p.target("core-rtr-1"); target.address != "192.0.2.100:8728" {
+		t.Errorf("expected the configured target, got %+v", target)
+	}
+	if _, ok := p.target("branches"); ok {
+		t.Errorf("expected the srv group to shadow the discovered device")
+	}
+	if target, ok := p.target("branch-rtr-1"); !ok || target.address != "192.0.2.3:8728" {
+		t.Errorf("expected the discovered device at 192.0.2.3:8728, got %+v", target)
+	}
+}
+
+func TestProberMNDP(t *testing.T) {
+	p, err := NewProber(&config.Config{
+		Modules: map[string]config.Module{
+			"default": {Username: "prometheus", Password: "changeme"},
+		},
+		MNDP: &config.MNDP{
+			Listen: "127.0.0.1:0",
+			Rules:  []config.MNDPRule{{Module: "default"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+
+	conn, err := net.Dial("udp", p.mndp.l.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(mndpAnnouncement("48:8f:5a:00:00:01", "branch-rtr-1", "RB5009UG+S+", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `"__param_target":"branch-rtr-1"`
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := httptest.NewRecorder()
+		p.SDHandler("").ServeHTTP(w, httptest.NewRequest("GET", "/sd", nil))
+		if strings.Contains(w.Body.String(), expected) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s in:\n%s", expected, w.Body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if target, ok := p.target("branch-rtr-1"); !ok || target.address != "127.0.0.1:8728" {
+		t.Errorf("expected target at 127.0.0.1:8728, got %+v", target)
+	}
+
+	// reloading with the same listen address keeps the inventory
+	listener := p.mndp.l
+	err = p.Reload(&config.Config{
+		Modules: map[string]config.Module{
+			"default": {Username: "prometheus", Password: "changeme"},
+		},
+		MNDP: &config.MNDP{
+			Listen: "127.0.0.1:0",
+			Rules:  []config.MNDPRule{{Module: "default"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.mndp.l != listener {
+		t.Errorf("listener was replaced")
+	}
+	if _, ok := p.target("branch-rtr-1"); !ok {
+		t.Errorf("discovered target was lost on reload")
+	}
+}
@@ -12,6 +12,14 @@ type monitorCollector struct {
 	descriptions map[string]*prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "monitor",
+		newCollector: newMonitorCollector,
+		description:  "ethernet link status, rate and duplex",
+	})
+}
+
 func newMonitorCollector() routerOSCollector {
 	c := &monitorCollector{}
 	c.init()
@@ -44,6 +52,14 @@ func (c *monitorCollector) collect(ctx *collectorContext) error {
 		eths[idx] = eth.Map["name"]
 	}
 
+	eths, err = ctx.selectInterfaces(eths)
+	if err != nil {
+		return err
+	}
+	if len(eths) == 0 {
+		return nil
+	}
+
 	return c.collectForMonitor(ctx, eths)
 }
 
@@ -13,6 +13,14 @@ type netwatchCollector struct {
 	descriptions map[string]*prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "netwatch",
+		newCollector: newNetwatchCollector,
+		description:  "netwatch host status",
+	})
+}
+
 func newNetwatchCollector() routerOSCollector {
 	c := &netwatchCollector{}
 	c.init()
@@ -19,6 +19,14 @@ type opticsCollector struct {
 	props           []string
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "optics",
+		newCollector: newOpticsCollector,
+		description:  "SFP module levels and temperatures",
+	})
+}
+
 func newOpticsCollector() routerOSCollector {
 	const prefix = "optics"
 
@@ -59,6 +67,10 @@ func (c *opticsCollector) collect(ctx *collectorContext) error {
 		}
 	}
 
+	ifaces, err = ctx.selectInterfaces(ifaces)
+	if err != nil {
+		return err
+	}
 	if len(ifaces) == 0 {
 		return nil
 	}
@@ -67,7 +79,7 @@ func (c *opticsCollector) collect(ctx *collectorContext) error {
 }
 
 func (c *opticsCollector) collectOpticalMetricsForInterfaces(ctx *collectorContext, ifaces []string) error {
-	reply, err := ctx.client.Run("/interface/ethernet/monitor",
+	reply, err := ctx.Run("/interface/ethernet/monitor",
 		"=numbers="+strings.Join(ifaces, ","),
 		"=once=",
 		"=.proplist=name,"+strings.Join(c.props, ","))
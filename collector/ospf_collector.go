@@ -0,0 +1,239 @@
+package collector
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ospfNeighborStates are the values of mikrotik_ospf_neighbor_state, from the
+// established adjacency down.
+var ospfNeighborStates = map[string]float64{
+	"full":     1,
+	"loading":  2,
+	"exchange": 3,
+	"exstart":  4,
+	"2-way":    5,
+	"init":     6,
+	"attempt":  7,
+	"down":     8,
+}
+
+// ospfV6NeighborProps maps the RouterOS 7 neighbor properties the collector
+// reads to their RouterOS 6 names.
+var ospfV6NeighborProps = map[string]string{
+	"dr":  "dr-address",
+	"bdr": "backup-dr-address",
+}
+
+type ospfCollector struct {
+	neighborProps    []string
+	neighborDescs    map[string]*prometheus.Desc
+	lsaCountDesc     *prometheus.Desc
+	instanceInfoDesc *prometheus.Desc
+}
+
+func init() {
+	registerCollector(collectorFactory{
+		name:         "ospf",
+		newCollector: newOSPFCollector,
+		description:  "OSPF neighbor adjacencies, LSA counts and instances",
+	})
+}
+
+func newOSPFCollector() routerOSCollector {
+	c := &ospfCollector{}
+	c.init()
+	return c
+}
+
+func (c *ospfCollector) init() {
+	c.neighborProps = []string{"instance", "area", "interface", "router-id", "address", "dr", "bdr", "state", "state-changes", "adjacency"}
+
+	const prefix = "ospf"
+	labelNames := []string{"instance", "area", "interface", "router_id", "address"}
+
+	c.neighborDescs = map[string]*prometheus.Desc{
+		"state":         description(prefix, "neighbor_state", "OSPF neighbor state (full = 1, loading = 2, exchange = 3, exstart = 4, 2-way = 5, init = 6, attempt = 7, down = 8)", labelNames),
+		"state-changes": description(prefix, "neighbor_state_changes", "number of OSPF neighbor state changes", labelNames),
+		"adjacency":     description(prefix, "neighbor_adjacency_seconds", "time the OSPF adjacency has been up", labelNames),
+		"role":          description(prefix, "neighbor_role", "role of the OSPF neighbor on its network (dr = 1, bdr = 2, other = 3)", labelNames),
+	}
+	c.lsaCountDesc = description(prefix, "lsa_count", "number of LSAs in the OSPF database", []string{"instance", "area", "type"})
+	c.instanceInfoDesc = description(prefix, "instance_info", "OSPF instance, always 1", []string{"instance", "router_id"})
+}
+
+func (c *ospfCollector) describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.neighborDescs {
+		ch <- d
+	}
+	ch <- c.lsaCountDesc
+	ch <- c.instanceInfoDesc
+}
+
+func (c *ospfCollector) collect(ctx *collectorContext) error {
+	major, err := ctx.majorVersion()
+	if err != nil {
+		return err
+	}
+
+	if err := c.collectInstances(ctx, major); err != nil {
+		return err
+	}
+	if err := c.collectNeighbors(ctx, major); err != nil {
+		return err
+	}
+
+	return c.collectLSAs(ctx)
+}
+
+func (c *ospfCollector) collectInstances(ctx *collectorContext, major int) error {
+	reply, err := ctx.Run("/routing/ospf/instance/print", "=.proplist=name,router-id")
+	if err != nil {
+		return err
+	}
+
+	var routerIDs map[string]string
+	if major >= 7 {
+		routerIDs, err = c.fetchRouterIDs(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, re := range reply.Re {
+		routerID := re.Map["router-id"]
+		if id, ok := routerIDs[routerID]; ok {
+			routerID = id
+		}
+		ctx.ch <- prometheus.MustNewConstMetric(c.instanceInfoDesc, prometheus.GaugeValue, 1, re.Map["name"], routerID)
+	}
+
+	return nil
+}
+
+// fetchRouterIDs returns the addresses of the /routing/id entries by name. On
+// RouterOS 7 the router-id of an OSPF instance names such an entry, whose id
+// is empty if the address is picked by the device. Router ids given as an
+// address match no entry and are kept.
+func (c *ospfCollector) fetchRouterIDs(ctx *collectorContext) (map[string]string, error) {
+	reply, err := ctx.Run("/routing/id/print", "=.proplist=name,id,dynamic-id")
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]string, len(reply.Re))
+	for _, re := range reply.Re {
+		id := re.Map["id"]
+		if id == "" {
+			id = re.Map["dynamic-id"]
+		}
+		ids[re.Map["name"]] = id
+	}
+
+	return ids, nil
+}
+
+func (c *ospfCollector) collectNeighbors(ctx *collectorContext, major int) error {
+	props := c.neighborProps
+	if major < 7 {
+		props = make([]string, len(c.neighborProps))
+		for i, p := range c.neighborProps {
+			if v6, ok := ospfV6NeighborProps[p]; ok {
+				p = v6
+			}
+			props[i] = p
+		}
+	}
+
+	reply, err := ctx.Run("/routing/ospf/neighbor/print", "=.proplist="+strings.Join(props, ","))
+	if err != nil {
+		return err
+	}
+
+	for _, re := range reply.Re {
+		neighbor := re.Map
+		if major < 7 {
+			neighbor = make(map[string]string, len(re.Map))
+			for k, v := range re.Map {
+				neighbor[k] = v
+			}
+			for v7, v6 := range ospfV6NeighborProps {
+				neighbor[v7] = re.Map[v6]
+			}
+		}
+		c.collectForNeighbor(ctx, neighbor)
+	}
+
+	return nil
+}
+
+func (c *ospfCollector) collectForNeighbor(ctx *collectorContext, neighbor map[string]string) {
+	address := neighbor["address"]
+	labelValues := []string{neighbor["instance"], neighbor["area"], neighbor["interface"], neighbor["router-id"], address}
+
+	if v, ok := ospfNeighborStates[strings.ToLower(neighbor["state"])]; ok {
+		ctx.ch <- prometheus.MustNewConstMetric(c.neighborDescs["state"], prometheus.GaugeValue, v, labelValues...)
+	}
+
+	role := 3.0
+	switch {
+	case address == "":
+	case address == neighbor["dr"]:
+		role = 1
+	case address == neighbor["bdr"]:
+		role = 2
+	}
+	ctx.ch <- prometheus.MustNewConstMetric(c.neighborDescs["role"], prometheus.GaugeValue, role, labelValues...)
+
+	for _, p := range []string{"state-changes", "adjacency"} {
+		value := neighbor[p]
+		if value == "" {
+			continue
+		}
+
+		var v float64
+		var err error
+		valueType := prometheus.GaugeValue
+		if p == "adjacency" {
+			v, err = parseUptime(value)
+		} else {
+			v, err = strconv.ParseFloat(value, 64)
+			valueType = prometheus.CounterValue
+		}
+		if err != nil {
+			ctx.log.Error(
+				"error parsing ospf metric value",
+				"address", address,
+				"property", p,
+				"value", value,
+				"err", err,
+			)
+			continue
+		}
+
+		ctx.ch <- prometheus.MustNewConstMetric(c.neighborDescs[p], valueType, v, labelValues...)
+	}
+}
+
+func (c *ospfCollector) collectLSAs(ctx *collectorContext) error {
+	reply, err := ctx.Run("/routing/ospf/lsa/print", "=.proplist=instance,area,type")
+	if err != nil {
+		return err
+	}
+
+	type lsaKey struct {
+		instance, area, typ string
+	}
+	counts := map[lsaKey]float64{}
+	for _, re := range reply.Re {
+		counts[lsaKey{re.Map["instance"], re.Map["area"], re.Map["type"]}]++
+	}
+
+	for k, v := range counts {
+		ctx.ch <- prometheus.MustNewConstMetric(c.lsaCountDesc, prometheus.GaugeValue, v, k.instance, k.area, k.typ)
+	}
+
+	return nil
+}
@@ -15,6 +15,14 @@ type poeCollector struct {
 	props       []string
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "poe",
+		newCollector: newPOECollector,
+		description:  "PoE output status, current and power",
+	})
+}
+
 func newPOECollector() routerOSCollector {
 	const prefix = "poe"
 
@@ -45,6 +53,10 @@ func (c *poeCollector) collect(ctx *collectorContext) error {
 		ifaces = append(ifaces, n)
 	}
 
+	ifaces, err = ctx.selectInterfaces(ifaces)
+	if err != nil {
+		return err
+	}
 	if len(ifaces) == 0 {
 		return nil
 	}
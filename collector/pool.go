@@ -0,0 +1,263 @@
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-routeros/routeros/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sessionIdleTimeout is how long an unused session is kept open.
+const sessionIdleTimeout = 5 * time.Minute
+
+type poolKey struct {
+	c      *collector
+	target string
+}
+
+// session is an authenticated API session to a device.
+type session struct {
+	key      poolKey
+	client   *routeros.Client
+	creds    [sha256.Size]byte
+	asyncErr <-chan error
+	lastUsed time.Time
+	// set once a command failed other than with a trap of the device
+	broken atomic.Bool
+}
+
+// alive reports whether the session's connection is still open. A cancelled
+// command ends the async loop of go-routeros, which alive only notices once
+// the loop has returned, so sessions with failed commands count as dead
+// right away.
+func (s *session) alive() bool {
+	if s.broken.Load() {
+		return false
+	}
+
+	select {
+	case <-s.asyncErr:
+		return false
+	default:
+		return true
+	}
+}
+
+// fail marks s as dead if err is a context or connection error. Traps of the
+// device leave the session usable.
+func (s *session) fail(err error) {
+	var deviceErr *routeros.DeviceError
+	if err != nil && !errors.As(err, &deviceErr) {
+		s.broken.Store(true)
+	}
+}
+
+func credentialsHash(username, password string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(username + "\x00" + password))
+}
+
+// connPool caches sessions by target and module so that devices are not dialed
+// and logged into on every scrape. Sessions are checked out exclusively, so
+// concurrent scrapes of the same device open additional sessions.
+type connPool struct {
+	idleTimeout time.Duration
+
+	mu   sync.Mutex
+	idle map[poolKey][]*session
+	// set by shutdown, sessions put back afterwards are closed
+	closed bool
+	done   chan struct{}
+
+	openSessions *prometheus.GaugeVec
+	dials        *prometheus.CounterVec
+	reuses       *prometheus.CounterVec
+}
+
+func newConnPool(idleTimeout time.Duration) *connPool {
+	const subsystem = "exporter"
+
+	labelNames := []string{"module"}
+	p := &connPool{
+		idleTimeout: idleTimeout,
+		idle:        make(map[poolKey][]*session),
+		done:        make(chan struct{}),
+		openSessions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "sessions_open",
+			Help:      "Number of open API sessions to devices",
+		}, labelNames),
+		dials: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "session_dials_total",
+			Help:      "Number of API sessions dialed",
+		}, labelNames),
+		reuses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "session_reuses_total",
+			Help:      "Number of scrapes that reused a cached API session",
+		}, labelNames),
+	}
+	go p.evictLoop()
+
+	return p
+}
+
+// evictLoop closes idle sessions until the pool is shut down, so that sessions
+// to targets that are no longer probed do not stay open.
+func (p *connPool) evictLoop() {
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			p.evictIdle(now)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// shutdown closes the idle sessions and stops the eviction. Sessions checked
+// out at that moment are closed when they are put back.
+func (p *connPool) shutdown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.done)
+
+	for key, sessions := range p.idle {
+		for _, s := range sessions {
+			p.close(s)
+		}
+		delete(p.idle, key)
+	}
+}
+
+// get returns a cached session for target, or dials a new one.
+func (p *connPool) get(ctx context.Context, c *collector, target string) (*session, error) {
+	username, password, err := c.credentials()
+	if err != nil {
+		return nil, fmt.Errorf("credentials: %w", err)
+	}
+	key := poolKey{c: c, target: target}
+	creds := credentialsHash(username, password)
+
+	p.mu.Lock()
+	p.evictIdle(time.Now())
+	var s *session
+	for len(p.idle[key]) > 0 && s == nil {
+		last := len(p.idle[key]) - 1
+		s = p.idle[key][last]
+		p.idle[key] = p.idle[key][:last]
+
+		if !s.alive() || s.creds != creds {
+			p.close(s)
+			s = nil
+		}
+	}
+	if len(p.idle[key]) == 0 {
+		delete(p.idle, key)
+	}
+	p.mu.Unlock()
+
+	if s != nil {
+		p.reuses.WithLabelValues(c.module).Inc()
+		return s, nil
+	}
+
+	s, err = c.dial(ctx, target, username, password)
+	if err != nil {
+		return nil, err
+	}
+	p.dials.WithLabelValues(c.module).Inc()
+	p.openSessions.WithLabelValues(c.module).Inc()
+
+	return s, nil
+}
+
+// put returns s to the pool, closing it if its connection has died or the pool
+// was shut down.
+func (p *connPool) put(s *session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || !s.alive() {
+		p.close(s)
+		return
+	}
+
+	s.lastUsed = time.Now()
+	p.idle[s.key] = append(p.idle[s.key], s)
+}
+
+// retain closes the idle sessions of collectors for which keep returns false.
+func (p *connPool) retain(keep func(c *collector) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, sessions := range p.idle {
+		if keep(key.c) {
+			continue
+		}
+
+		for _, s := range sessions {
+			p.close(s)
+		}
+		delete(p.idle, key)
+	}
+}
+
+// evictIdle closes sessions unused since idleTimeout. p.mu must be held.
+func (p *connPool) evictIdle(now time.Time) {
+	for key, sessions := range p.idle {
+		keep := sessions[:0]
+		for _, s := range sessions {
+			if now.Sub(s.lastUsed) > p.idleTimeout {
+				p.close(s)
+			} else {
+				keep = append(keep, s)
+			}
+		}
+
+		if len(keep) == 0 {
+			delete(p.idle, key)
+		} else {
+			p.idle[key] = keep
+		}
+	}
+}
+
+func (p *connPool) close(s *session) {
+	_ = s.client.Close()
+	p.openSessions.WithLabelValues(s.key.c.module).Dec()
+}
+
+// Describe implements prometheus.Collector
+func (p *connPool) Describe(ch chan<- *prometheus.Desc) {
+	p.openSessions.Describe(ch)
+	p.dials.Describe(ch)
+	p.reuses.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (p *connPool) Collect(ch chan<- prometheus.Metric) {
+	p.openSessions.Collect(ch)
+	p.dials.Collect(ch)
+	p.reuses.Collect(ch)
+}
@@ -18,6 +18,14 @@ func (c *poolCollector) init() {
 	c.usedCountDesc = description(prefix, "pool_used_count", "number of used IP/prefixes in a pool", labelNames)
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "pools",
+		newCollector: newPoolCollector,
+		description:  "IP pool usage",
+	})
+}
+
 func newPoolCollector() routerOSCollector {
 	c := &poolCollector{}
 	c.init()
@@ -63,7 +71,7 @@ func (c *poolCollector) fetchPoolNames(ctx *collectorContext, topic string) ([]s
 }
 
 func (c *poolCollector) collectForPool(ctx *collectorContext, ipVersion, topic, pool string) error {
-	reply, err := ctx.client.Run(fmt.Sprintf("/%s/pool/used/print", topic), fmt.Sprintf("?pool=%s", pool), "=count-only=")
+	reply, err := ctx.Run(fmt.Sprintf("/%s/pool/used/print", topic), fmt.Sprintf("?pool=%s", pool), "=count-only=")
 	if err != nil {
 		ctx.log.Error(
 			"error fetching pool counts",
@@ -0,0 +1,238 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mikrotik-exporter/config"
+	"mikrotik-exporter/internal/routerostest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newPoolTestCollector(t *testing.T, pool *connPool, extra ...routerostest.Reply) (*collector, *routerostest.Server) {
+	t.Helper()
+
+	replies, err := routerostest.LoadFile(filepath.Join("testdata", "v6", "resource.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := routerostest.NewServer(t, append(replies, extra...))
+	if pool != nil {
+		t.Cleanup(pool.shutdown)
+	}
+
+	c := newFixtureCollector(t, srv, mustCollectorList(t, config.Features{"resource": true})...).c
+	c.module = "default"
+	c.pool = pool
+
+	return c, srv
+}
+
+func scrape(t *testing.T, c *collector, target string) {
+	t.Helper()
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		for range ch {
+		}
+	}()
+	defer close(ch)
+
+	err := c.connectAndCollect(context.Background(), target, c.collectors, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnPoolReuse(t *testing.T) {
+	pool := newConnPool(sessionIdleTimeout)
+	c, srv := newPoolTestCollector(t, pool)
+
+	scrape(t, c, srv.Addr())
+	scrape(t, c, srv.Addr())
+
+	if n := srv.Logins(); n != 1 {
+		t.Errorf("expected 1 login, got %d", n)
+	}
+
+	want := `# HELP mikrotik_exporter_session_dials_total Number of API sessions dialed
+# TYPE mikrotik_exporter_session_dials_total counter
+mikrotik_exporter_session_dials_total{module="default"} 1
+# HELP mikrotik_exporter_session_reuses_total Number of scrapes that reused a cached API session
+# TYPE mikrotik_exporter_session_reuses_total counter
+mikrotik_exporter_session_reuses_total{module="default"} 1
+# HELP mikrotik_exporter_sessions_open Number of open API sessions to devices
+# TYPE mikrotik_exporter_sessions_open gauge
+mikrotik_exporter_sessions_open{module="default"} 1
+`
+	err := testutil.CollectAndCompare(pool, strings.NewReader(want))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnPoolDeadSession(t *testing.T) {
+	pool := newConnPool(sessionIdleTimeout)
+	c, srv := newPoolTestCollector(t, pool)
+
+	scrape(t, c, srv.Addr())
+	srv.CloseConnections()
+
+	s := pool.idle[poolKey{c: c, target: srv.Addr()}][0]
+	deadline := time.Now().Add(5 * time.Second)
+	for s.alive() {
+		if time.Now().After(deadline) {
+			t.Fatal("session still alive after its connection was closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	scrape(t, c, srv.Addr())
+
+	if n := srv.Logins(); n != 2 {
+		t.Errorf("expected 2 logins, got %d", n)
+	}
+}
+
+func TestConnPoolTimedOutScrape(t *testing.T) {
+	conntrack, err := routerostest.LoadFile(filepath.Join("testdata", "v6", "conntrack.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conntrack[0].Delay = 10 * time.Second
+
+	pool := newConnPool(sessionIdleTimeout)
+	c, srv := newPoolTestCollector(t, pool, conntrack...)
+
+	// the scrape deadline cancels the session while conntrack waits for its
+	// reply
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	ch := make(chan prometheus.Metric)
+	go func() {
+		for range ch {
+		}
+	}()
+	err = c.connectAndCollect(ctx, srv.Addr(), mustCollectorList(t, config.Features{"conntrack": true, "resource": true}), ch)
+	close(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc := &fixtureCollector{t: t, c: c, target: srv.Addr()}
+	want := `# HELP mikrotik_scrape_collector_success mikrotik_exporter: whether a device collector succeeded
+# TYPE mikrotik_scrape_collector_success gauge
+mikrotik_scrape_collector_success{collector="resource"} 1
+`
+	err = testutil.CollectAndCompare(fc, strings.NewReader(want), "mikrotik_scrape_collector_success")
+	if err != nil {
+		t.Error(err)
+	}
+	if n := srv.Logins(); n != 2 {
+		t.Errorf("expected 2 logins, got %d", n)
+	}
+
+	// the session is closed even if the async loop has not ended yet
+	s, err := pool.get(context.Background(), c, srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.release(ctx, s)
+	if n := len(pool.idle); n != 0 {
+		t.Errorf("expected no idle sessions, got %d", n)
+	}
+}
+
+func TestConnPoolCredentialsChange(t *testing.T) {
+	pool := newConnPool(sessionIdleTimeout)
+	c, srv := newPoolTestCollector(t, pool)
+
+	dir := t.TempDir()
+	c.usernameFile = filepath.Join(dir, "username")
+	c.passwordFile = filepath.Join(dir, "password")
+	writeFile := func(name, content string) {
+		err := os.WriteFile(name, []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(c.usernameFile, "prometheus")
+	writeFile(c.passwordFile, "changeme")
+
+	scrape(t, c, srv.Addr())
+	scrape(t, c, srv.Addr())
+	writeFile(c.passwordFile, "rotated")
+	scrape(t, c, srv.Addr())
+
+	if n := srv.Logins(); n != 2 {
+		t.Errorf("expected 2 logins, got %d", n)
+	}
+	if n := testutil.ToFloat64(pool.openSessions); n != 1 {
+		t.Errorf("expected 1 open session, got %f", n)
+	}
+}
+
+func TestConnPoolEvictIdle(t *testing.T) {
+	pool := newConnPool(time.Minute)
+	c, srv := newPoolTestCollector(t, pool)
+
+	scrape(t, c, srv.Addr())
+
+	pool.mu.Lock()
+	pool.evictIdle(time.Now().Add(2 * time.Minute))
+	pool.mu.Unlock()
+
+	if n := len(pool.idle); n != 0 {
+		t.Errorf("expected no idle sessions, got %d", n)
+	}
+	if n := testutil.ToFloat64(pool.openSessions); n != 0 {
+		t.Errorf("expected 0 open sessions, got %f", n)
+	}
+}
+
+func TestConnPoolEvictLoop(t *testing.T) {
+	pool := newConnPool(20 * time.Millisecond)
+	c, srv := newPoolTestCollector(t, pool)
+
+	scrape(t, c, srv.Addr())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(pool.openSessions) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle session was not evicted without further scrapes")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnPoolShutdown(t *testing.T) {
+	pool := newConnPool(sessionIdleTimeout)
+	c, srv := newPoolTestCollector(t, pool)
+
+	scrape(t, c, srv.Addr())
+	s, err := pool.get(context.Background(), c, srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrape(t, c, srv.Addr())
+
+	pool.shutdown()
+	if n := len(pool.idle); n != 0 {
+		t.Errorf("expected no idle sessions, got %d", n)
+	}
+
+	// a session checked out during the shutdown is closed when put back
+	pool.put(s)
+	if n := len(pool.idle); n != 0 {
+		t.Errorf("expected no idle sessions, got %d", n)
+	}
+	if n := testutil.ToFloat64(pool.openSessions); n != 0 {
+		t.Errorf("expected 0 open sessions, got %f", n)
+	}
+}
@@ -0,0 +1,206 @@
+package collector
+
+import (
+	"strconv"
+	"strings"
+
+	"mikrotik-exporter/config"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pppDefaultProfile is the profile of secrets using the default profile of the
+// PPP server.
+const pppDefaultProfile = "default"
+
+type pppCollector struct {
+	cfg            config.PPP
+	activeProps    []string
+	interfaceProps []string
+	countDesc      *prometheus.Desc
+	uptimeDesc     *prometheus.Desc
+	descriptions   map[string]*prometheus.Desc
+}
+
+func init() {
+	registerCollector(collectorFactory{
+		name:         "ppp",
+		newCollector: newPPPCollector,
+		description:  "active PPP sessions and their traffic",
+	})
+}
+
+func newPPPCollector() routerOSCollector {
+	c := &pppCollector{}
+	c.init()
+	return c
+}
+
+func (c *pppCollector) init() {
+	c.activeProps = []string{"name", "service", "caller-id", "address", "uptime", "radius"}
+	c.interfaceProps = []string{"name", "rx-byte", "tx-byte", "rx-packet", "tx-packet"}
+
+	const prefix = "ppp"
+	c.countDesc = description(prefix, "active_sessions", "number of active PPP sessions", []string{"service", "profile"})
+
+	labelNames := []string{"name", "service", "caller_id", "address"}
+	c.uptimeDesc = description(prefix, "session_uptime_seconds", "time the PPP session has been up", labelNames)
+	c.descriptions = make(map[string]*prometheus.Desc)
+	for _, p := range c.interfaceProps[1:] {
+		c.descriptions[p] = descriptionForPropertyName(prefix+"_session", p, labelNames)
+	}
+}
+
+// configure applies the ppp config of a module.
+func (c *pppCollector) configure(cfg config.PPP) {
+	c.cfg = cfg
+}
+
+func (c *pppCollector) describe(ch chan<- *prometheus.Desc) {
+	ch <- c.countDesc
+	ch <- c.uptimeDesc
+	for _, d := range c.descriptions {
+		ch <- d
+	}
+}
+
+func (c *pppCollector) collect(ctx *collectorContext) error {
+	sessions, err := c.fetch(ctx, "/ppp/active/print", c.activeProps)
+	if err != nil {
+		return err
+	}
+
+	profiles, err := c.profiles(ctx, sessions)
+	if err != nil {
+		return err
+	}
+
+	type countKey struct {
+		service, profile string
+	}
+	counts := map[countKey]float64{}
+	for _, re := range sessions {
+		profile := ""
+		if re.Map["radius"] != "true" {
+			profile = profiles[re.Map["name"]]
+		}
+		// secrets with the default profile use the default profile of the
+		// server they connected to, which is not known either
+		if profile == pppDefaultProfile {
+			profile = ""
+		}
+		counts[countKey{re.Map["service"], profile}]++
+	}
+	for k, v := range counts {
+		ctx.ch <- prometheus.MustNewConstMetric(c.countDesc, prometheus.GaugeValue, v, k.service, k.profile)
+	}
+
+	if !c.cfg.Sessions || len(sessions) == 0 {
+		return nil
+	}
+
+	interfaces, err := c.fetch(ctx, "/interface/print", c.interfaceProps, "?dynamic=true")
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*proto.Sentence, len(interfaces))
+	for _, re := range interfaces {
+		byName[re.Map["name"]] = re
+	}
+
+	for _, re := range sessions {
+		c.collectForSession(ctx, re, byName)
+	}
+
+	return nil
+}
+
+// profiles returns the profiles of the PPP secrets by name. Neither /ppp/active
+// nor the dynamic interfaces have the profile of a session, but sessions
+// authenticated by a local secret use the profile of the secret. The profile of
+// sessions authenticated by RADIUS is unknown, so the secrets are only fetched
+// if there are other sessions.
+func (c *pppCollector) profiles(ctx *collectorContext, sessions []*proto.Sentence) (map[string]string, error) {
+	local := false
+	for _, re := range sessions {
+		if re.Map["radius"] != "true" {
+			local = true
+			break
+		}
+	}
+	if !local {
+		return nil, nil
+	}
+
+	secrets, err := c.fetch(ctx, "/ppp/secret/print", []string{"name", "profile"})
+	if err != nil {
+		return nil, err
+	}
+	profiles := make(map[string]string, len(secrets))
+	for _, re := range secrets {
+		profiles[re.Map["name"]] = re.Map["profile"]
+	}
+
+	return profiles, nil
+}
+
+func (c *pppCollector) fetch(ctx *collectorContext, command string, props []string, query ...string) ([]*proto.Sentence, error) {
+	words := append([]string{command}, query...)
+	words = append(words, "=.proplist="+strings.Join(props, ","))
+
+	reply, err := ctx.Run(words...)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Re, nil
+}
+
+func (c *pppCollector) collectForSession(ctx *collectorContext, re *proto.Sentence, interfaces map[string]*proto.Sentence) {
+	name := re.Map["name"]
+	service := re.Map["service"]
+	labelValues := []string{name, service, re.Map["caller-id"], re.Map["address"]}
+
+	if uptime := re.Map["uptime"]; uptime != "" {
+		v, err := parseUptime(uptime)
+		if err != nil {
+			ctx.log.Error(
+				"error parsing ppp metric value",
+				"session", name,
+				"property", "uptime",
+				"value", uptime,
+				"err", err,
+			)
+		} else {
+			ctx.ch <- prometheus.MustNewConstMetric(c.uptimeDesc, prometheus.GaugeValue, v, labelValues...)
+		}
+	}
+
+	// sessions get a dynamic interface such as <pppoe-user1>, unless a server
+	// binding names it
+	iface, ok := interfaces["<"+service+"-"+name+">"]
+	if !ok {
+		return
+	}
+	for _, p := range c.interfaceProps[1:] {
+		value := iface.Map[p]
+		if value == "" {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			ctx.log.Error(
+				"error parsing ppp metric value",
+				"session", name,
+				"property", p,
+				"value", value,
+				"err", err,
+			)
+			continue
+		}
+
+		ctx.ch <- prometheus.MustNewConstMetric(c.descriptions[p], prometheus.CounterValue, v, labelValues...)
+	}
+}
@@ -0,0 +1,45 @@
+package collector
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mikrotik-exporter/config"
+	"mikrotik-exporter/internal/routerostest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPPPCollectorSessions(t *testing.T) {
+	replies, err := routerostest.LoadFile(filepath.Join("testdata", "v7", "ppp.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := routerostest.NewServer(t, replies)
+
+	co := newPPPCollector().(*pppCollector)
+	co.configure(config.PPP{Sessions: true})
+
+	fc := newFixtureCollector(t, srv, namedCollector{"ppp", co})
+
+	want := `# HELP mikrotik_ppp_session_rx_byte rx-byte
+# TYPE mikrotik_ppp_session_rx_byte counter
+mikrotik_ppp_session_rx_byte{address="10.250.0.7",caller_id="198.51.100.77",name="branch-7",service="l2tp"} 555555
+mikrotik_ppp_session_rx_byte{address="100.64.0.11",caller_id="4C:5E:0C:11:22:33",name="user1001",service="pppoe"} 1.23456789e+08
+mikrotik_ppp_session_rx_byte{address="100.64.0.12",caller_id="4C:5E:0C:44:55:66",name="user1002",service="pppoe"} 1024
+# HELP mikrotik_ppp_session_uptime_seconds time the PPP session has been up
+# TYPE mikrotik_ppp_session_uptime_seconds gauge
+mikrotik_ppp_session_uptime_seconds{address="10.250.0.7",caller_id="198.51.100.77",name="branch-7",service="l2tp"} 604800
+mikrotik_ppp_session_uptime_seconds{address="100.64.0.11",caller_id="4C:5E:0C:11:22:33",name="user1001",service="pppoe"} 273906
+mikrotik_ppp_session_uptime_seconds{address="100.64.0.12",caller_id="4C:5E:0C:44:55:66",name="user1002",service="pppoe"} 750
+mikrotik_ppp_session_uptime_seconds{address="100.64.0.13",caller_id="4C:5E:0C:77:88:99",name="radius-user",service="pppoe"} 5
+`
+	err = testutil.CollectAndCompare(fc, strings.NewReader(want), "mikrotik_ppp_session_rx_byte", "mikrotik_ppp_session_uptime_seconds")
+	if err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(fc, "mikrotik_ppp_session_tx_packet"); n != 3 {
+		t.Errorf("expected 3 tx packet series, got %d", n)
+	}
+}
@@ -5,10 +5,17 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"mikrotik-exporter/config"
@@ -18,136 +25,223 @@ import (
 )
 
 const (
-	paramTarget = "target"
-	paramModule = "module"
+	paramTarget  = "target"
+	paramModule  = "module"
+	paramCollect = "collect[]"
+	paramExclude = "exclude[]"
+
+	headerScrapeTimeout = "X-Prometheus-Scrape-Timeout-Seconds"
 )
 
 type proberModule struct {
 	c       *collector
 	timeout time.Duration
+	// whether the identity of the device is added as a label to every metric
+	identityLabel bool
+}
+
+// proberTarget is a statically configured target that is probed by name.
+type proberTarget struct {
+	address string
+	module  string
+	// collector of the module, or a copy of it if the target overrides the credentials
+	c      *collector
+	labels prometheus.Labels
 }
 
 type Prober struct {
+	// TimeoutOffset is subtracted from the Prometheus scrape timeout so that
+	// results are returned before Prometheus gives up on the scrape.
+	TimeoutOffset time.Duration
+
+	mu      sync.RWMutex
 	modules map[string]proberModule
+	targets map[string]proberTarget
+	groups  map[string]*srvGroup
+	// stops the refresh of groups
+	stopGroups context.CancelFunc
+	// nil if MNDP discovery is disabled
+	mndp    *mndpDiscovery
+	pool    *connPool
+	metrics *exporterMetrics
 }
 
-func collectorList(f config.Features) []routerOSCollector {
-	c := []routerOSCollector{}
+func readCertificate(file string) (*x509.Certificate, error) {
+	const pemBlockCert = "CERTIFICATE"
 
-	if f.BGP {
-		c = append(c, newBGPCollector())
+	certBytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile: %w", err)
 	}
 
-	if f.Capsman {
-		c = append(c, newCapsmanCollector())
+	block, _ := pem.Decode(certBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found.")
 	}
 
-	if f.Conntrack {
-		c = append(c, newConntrackCollector())
+	if block.Type != pemBlockCert {
+		return nil, fmt.Errorf("unexpected block type: %s", block.Type)
 	}
 
-	if f.DHCP {
-		c = append(c, newDHCPCollector())
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate: %w", err)
 	}
 
-	if f.DHCPL {
-		c = append(c, newDHCPLCollector())
-	}
+	return c, nil
+}
 
-	if f.DHCPv6 {
-		c = append(c, newDHCPv6Collector())
+func NewProber(c *config.Config) (_ *Prober, err error) {
+	p := &Prober{
+		pool:    newConnPool(sessionIdleTimeout),
+		metrics: newExporterMetrics(),
 	}
+	defer func() {
+		if err != nil {
+			p.pool.shutdown()
+		}
+	}()
 
-	if f.Firmware {
-		c = append(c, newFirmwareCollector())
+	modules, err := p.newModules(c)
+	if err != nil {
+		return nil, err
 	}
-
-	if f.Health {
-		c = append(c, newhealthCollector())
+	if err = labelConflicts(c, modules); err != nil {
+		return nil, err
 	}
-
-	if f.Interface {
-		c = append(c, newInterfaceCollector())
+	groups, err := newSRVGroups(c, modules)
+	if err != nil {
+		return nil, err
 	}
-
-	if f.Ipsec {
-		c = append(c, newIpsecCollector())
+	if c.MNDP != nil {
+		p.mndp, err = newMNDPDiscovery(c.MNDP, nil)
+		if err != nil {
+			return nil, err
+		}
 	}
+	p.modules = modules
+	p.targets = newTargets(c, modules)
+	p.groups = groups
+	p.stopGroups = startSRVGroups(groups)
 
-	if f.Lte {
-		c = append(c, newLteCollector())
-	}
+	return p, nil
+}
 
-	if f.Netwatch {
-		c = append(c, newNetwatchCollector())
+// CheckConfig returns an error if NewProber would reject c. Unlike NewProber it
+// has no side effects: it neither listens for MNDP announcements nor resolves
+// SRV records.
+func CheckConfig(c *config.Config) error {
+	modules, err := (&Prober{}).newModules(c)
+	if err != nil {
+		return err
 	}
-
-	if f.Optics {
-		c = append(c, newOpticsCollector())
+	if err := labelConflicts(c, modules); err != nil {
+		return err
 	}
-
-	if f.POE {
-		c = append(c, newPOECollector())
+	if _, err := newSRVGroups(c, modules); err != nil {
+		return err
 	}
-
-	if f.Pools {
-		c = append(c, newPoolCollector())
+	if c.MNDP != nil {
+		if _, err := newMNDPRules(c.MNDP.Rules); err != nil {
+			return err
+		}
 	}
 
-	if f.Resource {
-		c = append(c, newResourceCollector())
-	}
+	return nil
+}
 
-	if f.Routes {
-		c = append(c, newRoutesCollector())
-	}
+// Close stops the background work of p and closes its sessions.
+func (p *Prober) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	if f.W60G {
-		c = append(c, neww60gInterfaceCollector())
+	p.stopGroups()
+	if p.mndp != nil {
+		p.mndp.l.close()
 	}
+	p.pool.shutdown()
+}
 
-	if f.WlanSTA {
-		c = append(c, newWlanSTACollector())
+// Reload replaces the modules and targets of p with those of c. If c is
+// invalid, the current ones are kept. Probes already in progress are not
+// affected.
+func (p *Prober) Reload(c *config.Config) error {
+	modules, err := p.newModules(c)
+	if err != nil {
+		return err
+	}
+	if err := labelConflicts(c, modules); err != nil {
+		return err
+	}
+	targets := newTargets(c, modules)
+	groups, err := newSRVGroups(c, modules)
+	if err != nil {
+		return err
+	}
+	var mndp *mndpDiscovery
+	if c.MNDP != nil {
+		mndp, err = newMNDPDiscovery(c.MNDP, p.mndp)
+		if err != nil {
+			return err
+		}
 	}
 
-	if f.WlanIF {
-		c = append(c, newWlanIFCollector())
+	p.mu.Lock()
+	p.modules = modules
+	p.targets = targets
+	p.groups = groups
+	p.stopGroups()
+	p.stopGroups = startSRVGroups(groups)
+	if p.mndp != nil && (mndp == nil || mndp.l != p.mndp.l) {
+		p.mndp.l.close()
 	}
+	p.mndp = mndp
+	p.mu.Unlock()
 
-	if f.Monitor {
-		c = append(c, newMonitorCollector())
+	current := map[*collector]bool{}
+	for _, m := range modules {
+		current[m.c] = true
+	}
+	for _, t := range targets {
+		current[t.c] = true
+	}
+	for _, g := range groups {
+		current[g.c] = true
 	}
 
-	return c
-}
+	// sessions of the replaced modules and targets will never be reused
+	p.pool.retain(func(co *collector) bool {
+		return current[co]
+	})
 
-func readCertificate(file string) (*x509.Certificate, error) {
-	const pemBlockCert = "CERTIFICATE"
+	return nil
+}
 
-	certBytes, err := os.ReadFile(file)
-	if err != nil {
-		return nil, fmt.Errorf("ReadFile: %w", err)
-	}
+func (p *Prober) target(name string) (proberTarget, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
-	block, _ := pem.Decode(certBytes)
-	if block == nil {
-		return nil, fmt.Errorf("no PEM data found.")
+	if t, ok := p.targets[name]; ok {
+		return t, true
 	}
-
-	if block.Type != pemBlockCert {
-		return nil, fmt.Errorf("unexpected block type: %s", block.Type)
+	// discovered names never shadow configured targets and groups
+	if _, ok := p.groups[name]; ok || p.mndp == nil {
+		return proberTarget{}, false
 	}
+	t, ok := p.mndp.targets(p.modules, time.Now())[name]
+	return t, ok
+}
 
-	c, err := x509.ParseCertificate(block.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing certificate: %w", err)
-	}
+func (p *Prober) module(name string) (proberModule, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
-	return c, nil
+	m, ok := p.modules[name]
+	return m, ok
 }
 
-func NewProber(c *config.Config) (http.Handler, error) {
-	p := &Prober{modules: make(map[string]proberModule, len(c.Modules))}
+func (p *Prober) newModules(c *config.Config) (map[string]proberModule, error) {
+	modules := make(map[string]proberModule, len(c.Modules))
 
 	for name, m := range c.Modules {
 		timeout := DefaultTimeout
@@ -173,20 +267,216 @@ func NewProber(c *config.Config) (http.Handler, error) {
 			}
 		}
 
-		p.modules[name] = proberModule{
-			timeout: timeout,
+		collectors, err := collectorList(m.Features)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", name, err)
+		}
+		interfaceFilter, err := newInterfaceFilter(m.Interfaces)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", name, err)
+		}
+		for _, co := range collectors {
+			switch co := co.routerOSCollector.(type) {
+			case *infoCollector:
+				if m.IdentityLabel {
+					// the identity is already a label of every metric
+					co.withoutIdentity()
+				}
+			case *firewallCollector:
+				co.configure(m.Firewall)
+			case *pppCollector:
+				co.configure(m.PPP)
+			}
+		}
+
+		modules[name] = proberModule{
+			timeout:       timeout,
+			identityLabel: m.IdentityLabel,
 			c: &collector{
-				tlsCfg:       tlsCfg,
-				collectors:   collectorList(m.Features),
-				usernameFile: m.UsernameFile,
-				passwordFile: m.PasswordFile,
-				usernameStr:  m.Username,
-				passwordStr:  m.Password,
+				module:          name,
+				pool:            p.pool,
+				metrics:         p.metrics,
+				tlsCfg:          tlsCfg,
+				interfaceFilter: interfaceFilter,
+				collectors:      append(collectors, customCollectorList(m.CustomCollectors)...),
+				concurrency:     m.Concurrency,
+				usernameFile:    m.UsernameFile,
+				passwordFile:    m.PasswordFile,
+				usernameStr:     m.Username,
+				passwordStr:     m.Password,
 			},
 		}
 	}
 
-	return p, nil
+	return modules, nil
+}
+
+func (p *Prober) srvGroup(name string) (*srvGroup, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	g, ok := p.groups[name]
+	return g, ok
+}
+
+// newSRVGroups returns the SRV groups of c.
+func newSRVGroups(c *config.Config, modules map[string]proberModule) (map[string]*srvGroup, error) {
+	groups := make(map[string]*srvGroup, len(c.SRVGroups))
+
+	for name, g := range c.SRVGroups {
+		m, ok := modules[g.Module]
+		if !ok {
+			continue
+		}
+
+		var resolvers []string
+		if g.Resolver != "" {
+			resolver, err := config.ResolverAddress(g.Resolver)
+			if err != nil {
+				return nil, fmt.Errorf("srv group %s: %w", name, err)
+			}
+			resolvers = []string{resolver}
+		} else {
+			var err error
+			resolvers, err = systemResolvers()
+			if err != nil {
+				return nil, fmt.Errorf("srv group %s: %w", name, err)
+			}
+		}
+
+		groups[name] = &srvGroup{
+			record:    g.Record,
+			resolvers: resolvers,
+			module:    g.Module,
+			c:         m.c,
+			labels:    g.Labels,
+		}
+	}
+
+	return groups, nil
+}
+
+// startSRVGroups starts refreshing groups in the background. The returned
+// function stops it.
+func startSRVGroups(groups map[string]*srvGroup) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, g := range groups {
+		go g.refresh(ctx)
+	}
+
+	return cancel
+}
+
+// newTargets returns the targets of c. Targets referring to a module missing
+// from modules are skipped, config.Load reports them.
+func newTargets(c *config.Config, modules map[string]proberModule) map[string]proberTarget {
+	targets := make(map[string]proberTarget, len(c.Targets))
+
+	for name, t := range c.Targets {
+		m, ok := modules[t.Module]
+		if !ok {
+			continue
+		}
+
+		co := m.c
+		switch {
+		case t.Username != "" || t.Password != "":
+			cp := *m.c
+			cp.usernameStr, cp.passwordStr = t.Username, t.Password
+			cp.usernameFile, cp.passwordFile = "", ""
+			co = &cp
+		case t.UsernameFile != "" || t.PasswordFile != "":
+			cp := *m.c
+			cp.usernameStr, cp.passwordStr = "", ""
+			cp.usernameFile, cp.passwordFile = t.UsernameFile, t.PasswordFile
+			co = &cp
+		}
+
+		targets[name] = proberTarget{
+			address: t.Address,
+			module:  t.Module,
+			c:       co,
+			labels:  t.Labels,
+		}
+	}
+
+	return targets
+}
+
+// labelConflicts returns an error if a target, SRV group or MNDP rule has a
+// label that a collector of its module adds as well, which would fail every
+// probe of it.
+func labelConflicts(c *config.Config, modules map[string]proberModule) error {
+	moduleLabels := map[string]map[string]string{}
+	labelsOf := func(module string) map[string]string {
+		if labels, ok := moduleLabels[module]; ok {
+			return labels
+		}
+		labels := map[string]string{}
+		if m, ok := modules[module]; ok {
+			for _, co := range m.c.collectors {
+				for _, d := range describedDescs(co.routerOSCollector) {
+					for _, l := range d.labels {
+						labels[l] = co.name
+					}
+				}
+			}
+		}
+		moduleLabels[module] = labels
+		return labels
+	}
+
+	var conflicts []string
+	check := func(kind, name, module string, labels map[string]string) {
+		for l := range labels {
+			if co, ok := labelsOf(module)[l]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("%s %s: label %q is added by collector %s of module %s", kind, name, l, co, module))
+			}
+		}
+	}
+	for name, t := range c.Targets {
+		check("target", name, t.Module, t.Labels)
+	}
+	for name, g := range c.SRVGroups {
+		// every device of a group is also labelled with its address
+		labels := map[string]string{labelAddress: ""}
+		for k, v := range g.Labels {
+			labels[k] = v
+		}
+		check("srv group", name, g.Module, labels)
+	}
+	if c.MNDP != nil {
+		for i, r := range c.MNDP.Rules {
+			check("mndp rule", strconv.Itoa(i), r.Module, r.Labels)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return errors.New(strings.Join(conflicts, "\n"))
+	}
+
+	return nil
+}
+
+// Describe implements prometheus.Collector
+func (p *Prober) Describe(ch chan<- *prometheus.Desc) {
+	p.pool.Describe(ch)
+	p.metrics.Describe(ch)
+	ch <- mndpLastSeenDesc
+}
+
+// Collect implements prometheus.Collector
+func (p *Prober) Collect(ch chan<- prometheus.Metric) {
+	p.pool.Collect(ch)
+	p.metrics.Collect(ch)
+
+	p.mu.RLock()
+	mndp := p.mndp
+	p.mu.RUnlock()
+	if mndp != nil {
+		mndp.collect(ch)
+	}
 }
 
 // ServeHTTP implements http.Handler
@@ -203,18 +493,81 @@ func (p *Prober) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	moduleName := r.URL.Query().Get(paramModule)
 
-	module, ok := p.modules[moduleName]
+	var labels prometheus.Labels
+	var c *collector
+	var group *srvGroup
+	if t, ok := p.target(target); ok {
+		if moduleName != "" && moduleName != t.module {
+			http.Error(w, fmt.Sprintf("target %s uses module %s", target, t.module), http.StatusBadRequest)
+			return
+		}
+		moduleName = t.module
+		target = t.address
+		labels = t.labels
+		c = t.c
+	} else if g, ok := p.srvGroup(target); ok {
+		if moduleName != "" && moduleName != g.module {
+			http.Error(w, fmt.Sprintf("srv group %s uses module %s", target, g.module), http.StatusBadRequest)
+			return
+		}
+		moduleName = g.module
+		c = g.c
+		group = g
+	}
+
+	module, ok := p.module(moduleName)
 	if !ok {
 		http.Error(w, "invalid module", http.StatusBadRequest)
 		return
 	}
+	if c == nil {
+		c = module.c
+		if !c.hasCredentials() {
+			http.Error(w, fmt.Sprintf("module %s has no credentials, probe one of its targets", moduleName), http.StatusBadRequest)
+			return
+		}
+	}
+
+	timeout, err := scrapeTimeout(r, module.timeout, p.TimeoutOffset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collectors, err := selectCollectors(r.URL.Query(), c.collectors)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("module %s: %s", moduleName, err), http.StatusBadRequest)
+		return
+	}
+
+	p.metrics.probesInFlight.Inc()
+	defer p.metrics.probesInFlight.Dec()
+	begin := time.Now()
+	defer func() {
+		p.metrics.probes.WithLabelValues(moduleName).Inc()
+		p.metrics.probeDuration.WithLabelValues(moduleName).Observe(time.Since(begin).Seconds())
+	}()
 
 	registry := prometheus.NewRegistry()
-	registry.MustRegister(&proberCollector{
-		c:       module.c,
-		target:  target,
-		timeout: module.timeout,
-	})
+	if group == nil {
+		if module.identityLabel {
+			begin := time.Now()
+			labels = withIdentity(r.Context(), c, target, labels, timeout)
+			timeout -= time.Since(begin)
+		}
+		err = prometheus.WrapRegistererWith(labels, registry).Register(&proberCollector{
+			c:          c,
+			collectors: collectors,
+			target:     target,
+			timeout:    timeout,
+		})
+	} else {
+		err = p.registerGroup(r.Context(), registry, group, collectors, timeout, module.identityLabel)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	promhttp.HandlerFor(registry, promhttp.HandlerOpts{
 		ErrorLog:      log.Default(),
@@ -222,10 +575,139 @@ func (p *Prober) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}).ServeHTTP(w, r)
 }
 
+// registerGroup registers a collector for every device of g. The metrics of a
+// device are labelled with its address.
+func (p *Prober) registerGroup(ctx context.Context, registry prometheus.Registerer, g *srvGroup, collectors []namedCollector, timeout time.Duration, identityLabel bool) error {
+	begin := time.Now()
+
+	devices, err := g.cached()
+	if err != nil {
+		return fmt.Errorf("srv lookup: %w", err)
+	}
+
+	deviceLabels := make([]prometheus.Labels, len(devices))
+	var wg sync.WaitGroup
+	for i, d := range devices {
+		labels := prometheus.Labels{labelAddress: d}
+		for k, v := range g.labels {
+			labels[k] = v
+		}
+		deviceLabels[i] = labels
+
+		if identityLabel {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				deviceLabels[i] = withIdentity(ctx, g.c, d, labels, timeout-time.Since(begin))
+			}()
+		}
+	}
+	wg.Wait()
+	timeout -= time.Since(begin)
+
+	for i, d := range devices {
+		err := prometheus.WrapRegistererWith(deviceLabels[i], registry).Register(&proberCollector{
+			c:          g.c,
+			collectors: collectors,
+			target:     d,
+			timeout:    timeout,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withIdentity returns a copy of labels with the identity of the device at
+// target added. labels is returned if the identity cannot be fetched, the
+// probe reports the device as down then.
+func withIdentity(ctx context.Context, c *collector, target string, labels prometheus.Labels, timeout time.Duration) prometheus.Labels {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	identity, err := c.identity(ctx, target)
+	if err != nil {
+		slog.Error("error fetching device identity", "target", target, "err", err)
+		return labels
+	}
+
+	l := make(prometheus.Labels, len(labels)+1)
+	for k, v := range labels {
+		l[k] = v
+	}
+	l["identity"] = identity
+
+	return l
+}
+
+// selectCollectors returns the collectors named by the collect[] parameters of
+// q, or all if there are none, without those named by the exclude[]
+// parameters. Every name must be one of collectors.
+func selectCollectors(q url.Values, collectors []namedCollector) ([]namedCollector, error) {
+	known := make(map[string]bool, len(collectors))
+	for _, co := range collectors {
+		known[co.name] = true
+	}
+
+	names := func(param string) (map[string]bool, error) {
+		m := map[string]bool{}
+		for _, name := range q[param] {
+			if !known[name] {
+				return nil, fmt.Errorf("collector %s is not enabled", name)
+			}
+			m[name] = true
+		}
+		return m, nil
+	}
+	collect, err := names(paramCollect)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := names(paramExclude)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := []namedCollector{}
+	for _, co := range collectors {
+		if (len(collect) == 0 || collect[co.name]) && !exclude[co.name] {
+			selected = append(selected, co)
+		}
+	}
+
+	return selected, nil
+}
+
+// scrapeTimeout returns the smaller of the module timeout and the scrape timeout
+// sent by Prometheus minus offset. The offset is ignored if it exceeds the
+// Prometheus timeout.
+func scrapeTimeout(r *http.Request, moduleTimeout, offset time.Duration) (time.Duration, error) {
+	v := r.Header.Get(headerScrapeTimeout)
+	if v == "" {
+		return moduleTimeout, nil
+	}
+
+	secs, err := strconv.ParseFloat(v, 64)
+	if err != nil || secs <= 0 {
+		return 0, fmt.Errorf("invalid %s header: %q", headerScrapeTimeout, v)
+	}
+
+	timeout := time.Duration(secs * float64(time.Second))
+	if timeout > offset {
+		timeout -= offset
+	}
+
+	return min(timeout, moduleTimeout), nil
+}
+
 type proberCollector struct {
-	c       *collector
-	target  string
-	timeout time.Duration
+	c *collector
+	// subset of the collectors of c to run
+	collectors []namedCollector
+	target     string
+	timeout    time.Duration
 }
 
 // Collect implements prometheus.Collector
@@ -234,15 +716,17 @@ func (pc *proberCollector) Collect(c chan<- prometheus.Metric) {
 	ctx, cancel := context.WithTimeout(context.Background(), pc.timeout)
 	defer cancel()
 
-	pc.c.collectForDevice(ctx, pc.target, c)
+	pc.c.collectForDevice(ctx, pc.target, pc.collectors, c)
 }
 
 // Describe implements prometheus.Collector
 func (pc *proberCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- upDesc
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	ch <- scrapeTimeoutDesc
 
-	for _, co := range pc.c.collectors {
+	for _, co := range pc.collectors {
 		co.describe(ch)
 	}
 }
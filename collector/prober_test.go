@@ -0,0 +1,326 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"mikrotik-exporter/config"
+	"mikrotik-exporter/internal/routerostest"
+)
+
+func TestScrapeTimeout(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   string
+		module   time.Duration
+		offset   time.Duration
+		expected time.Duration
+		hasError bool
+	}{
+		{"no header", "", 5 * time.Second, 500 * time.Millisecond, 5 * time.Second, false},
+		{"header shorter", "3", 5 * time.Second, 500 * time.Millisecond, 2500 * time.Millisecond, false},
+		{"header longer", "10", 5 * time.Second, 500 * time.Millisecond, 5 * time.Second, false},
+		{"fractional header", "1.5", 5 * time.Second, 0, 1500 * time.Millisecond, false},
+		{"offset exceeds header", "0.2", 5 * time.Second, 500 * time.Millisecond, 200 * time.Millisecond, false},
+		{"invalid header", "ten", 5 * time.Second, 0, 0, true},
+		{"negative header", "-1", 5 * time.Second, 0, 0, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/probe", nil)
+			if testCase.header != "" {
+				r.Header.Set(headerScrapeTimeout, testCase.header)
+			}
+
+			timeout, err := scrapeTimeout(r, testCase.module, testCase.offset)
+			if testCase.hasError && err == nil {
+				t.Fatalf("expected an error but got nil")
+			} else if !testCase.hasError && err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			if timeout != testCase.expected {
+				t.Errorf("expected %s, got %s", testCase.expected, timeout)
+			}
+		})
+	}
+}
+
+func TestProberReload(t *testing.T) {
+	p, err := NewProber(&config.Config{Modules: map[string]config.Module{
+		"default": {Features: config.Features{"resource": true}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Reload(&config.Config{Modules: map[string]config.Module{
+		"default": {Features: config.Features{"interface": true}},
+		"lte":     {Features: config.Features{"lte": true}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m, ok := p.module("default"); !ok || m.c.collectors[0].name != "interface" {
+		t.Errorf("module default was not replaced")
+	}
+	if _, ok := p.module("lte"); !ok {
+		t.Errorf("module lte was not added")
+	}
+
+	err = p.Reload(&config.Config{Modules: map[string]config.Module{
+		"default": {TLS: true, CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+	}})
+	if err == nil {
+		t.Fatal("expected an error but got nil")
+	}
+
+	if _, ok := p.module("lte"); !ok {
+		t.Errorf("invalid config replaced the current modules")
+	}
+}
+
+func TestProberStaticTargets(t *testing.T) {
+	replies, err := routerostest.LoadFile(filepath.Join("testdata", "v6", "resource.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := routerostest.NewServer(t, replies)
+	srv.SetCredentials("core", "secret")
+
+	p, err := NewProber(&config.Config{
+		Modules: map[string]config.Module{
+			"default": {Username: "prometheus", Password: "changeme", Features: config.Features{"resource": true}},
+			"other":   {Username: "prometheus", Password: "changeme"},
+			"nocreds": {Features: config.Features{"resource": true}},
+		},
+		Targets: map[string]config.Target{
+			"core-rtr-2": {
+				Address:  srv.Addr(),
+				Module:   "nocreds",
+				Username: "core",
+				Password: "secret",
+			},
+			"core-rtr-1": {
+				Address:  srv.Addr(),
+				Module:   "default",
+				Username: "core",
+				Password: "secret",
+				Labels:   map[string]string{"site": "dc1"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		query    string
+		status   int
+		expected []string
+	}{
+		{
+			name:   "by name",
+			query:  "target=core-rtr-1",
+			status: http.StatusOK,
+			expected: []string{
+				`mikrotik_up{site="dc1"} 1`,
+				`mikrotik_system_cpu_load{boardname="RB750Gr3",site="dc1",version="6.49.10 (long-term)"} 3`,
+			},
+		},
+		{
+			name:     "matching module",
+			query:    "target=core-rtr-1&module=default",
+			status:   http.StatusOK,
+			expected: []string{`mikrotik_up{site="dc1"} 1`},
+		},
+		{
+			name:   "other module",
+			query:  "target=core-rtr-1&module=other",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:     "by address",
+			query:    "target=" + srv.Addr() + "&module=default",
+			status:   http.StatusOK,
+			expected: []string{"mikrotik_up 0"},
+		},
+		{
+			name:     "module without credentials",
+			query:    "target=core-rtr-2",
+			status:   http.StatusOK,
+			expected: []string{"mikrotik_up 1"},
+		},
+		{
+			name:   "by address without credentials",
+			query:  "target=" + srv.Addr() + "&module=nocreds",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, httptest.NewRequest("GET", "/probe?"+testCase.query, nil))
+
+			if w.Code != testCase.status {
+				t.Fatalf("expected status %d, got %d: %s", testCase.status, w.Code, w.Body)
+			}
+			for _, e := range testCase.expected {
+				if !strings.Contains(w.Body.String(), e+"\n") {
+					t.Errorf("expected %q in:\n%s", e, w.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestProberIdentityLabel(t *testing.T) {
+	replies, err := routerostest.LoadFile(filepath.Join("testdata", "v6", "info.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := routerostest.NewServer(t, replies)
+
+	p, err := NewProber(&config.Config{
+		Modules: map[string]config.Module{
+			"default": {
+				Username:      "prometheus",
+				Password:      "changeme",
+				Features:      config.Features{"info": true},
+				IdentityLabel: true,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/probe?module=default&target="+srv.Addr(), nil))
+
+	for _, e := range []string{
+		`mikrotik_up{identity="branch-rtr-1"} 1`,
+		`mikrotik_device_info{architecture="mmips",board_name="hEX",current_firmware="6.49.10",firmware_type="mt7621L",identity="branch-rtr-1",model="RB750Gr3",platform="MikroTik",serial_number="8A2B09C1D3E4",upgrade_firmware="6.49.10",version="6.49.10 (long-term)"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), e+"\n") {
+			t.Errorf("expected %q in:\n%s", e, w.Body)
+		}
+	}
+}
+
+func TestSelectCollectors(t *testing.T) {
+	collectors := mustCollectorList(t, config.Features{"interface": true, "lte": true, "resource": true})
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected []string
+		hasError bool
+	}{
+		{"all", "", []string{"interface", "lte", "resource"}, false},
+		{"collect", "collect[]=interface&collect[]=resource", []string{"interface", "resource"}, false},
+		{"exclude", "exclude[]=lte", []string{"interface", "resource"}, false},
+		{"collect and exclude", "collect[]=lte&collect[]=resource&exclude[]=lte", []string{"resource"}, false},
+		{"not enabled", "collect[]=bgp", nil, true},
+		{"exclude not enabled", "exclude[]=bgp", nil, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			q, err := url.ParseQuery(testCase.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			selected, err := selectCollectors(q, collectors)
+			if testCase.hasError && err == nil {
+				t.Fatalf("expected an error but got nil")
+			} else if !testCase.hasError && err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			names := []string{}
+			for _, co := range selected {
+				names = append(names, co.name)
+			}
+			if !testCase.hasError && !slices.Equal(names, testCase.expected) {
+				t.Errorf("expected %v, got %v", testCase.expected, names)
+			}
+		})
+	}
+}
+
+func TestLabelConflicts(t *testing.T) {
+	c := &config.Config{
+		Modules: map[string]config.Module{
+			"default": {Features: config.Features{"interface": true, "resource": true}},
+			"ppp":     {Features: config.Features{"ppp": true}, PPP: config.PPP{Sessions: true}},
+		},
+		Targets: map[string]config.Target{
+			"core-rtr-1": {Module: "default", Labels: map[string]string{"site": "dc1"}},
+			"core-rtr-2": {Module: "default", Labels: map[string]string{"interface": "uplink"}},
+		},
+		SRVGroups: map[string]config.SRVGroup{
+			"branches": {Record: "_mikrotik._tcp.example.com", Module: "default"},
+			// the address label of the devices collides with the sessions
+			"concentrators": {Record: "_bng._tcp.example.com", Module: "ppp"},
+		},
+		MNDP: &config.MNDP{Rules: []config.MNDPRule{
+			{Module: "default", Labels: map[string]string{"version": "7"}},
+		}},
+	}
+
+	modules, err := (&Prober{}).newModules(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = labelConflicts(c, modules)
+	if err == nil {
+		t.Fatal("expected an error but got nil")
+	}
+	expected := "mndp rule 0: label \"version\" is added by collector resource of module default\n" +
+		"srv group concentrators: label \"address\" is added by collector ppp of module ppp\n" +
+		"target core-rtr-2: label \"interface\" is added by collector interface of module default"
+	if err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	stub := newDNSStub(t, nil, 300)
+	c := &config.Config{
+		Modules: map[string]config.Module{
+			"default": {Username: "prometheus", Password: "changeme", Features: config.Features{"interface": true}},
+		},
+		SRVGroups: map[string]config.SRVGroup{
+			"branches": {Record: "_mikrotik._tcp.example.com", Resolver: stub.addr(), Module: "default"},
+		},
+		MNDP: &config.MNDP{
+			Listen: "127.0.0.1:0",
+			Rules:  []config.MNDPRule{{Module: "default"}},
+		},
+	}
+
+	if err := CheckConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if q := stub.queryCount(); q != 0 {
+		t.Errorf("expected no srv lookups, got %d queries", q)
+	}
+
+	c.MNDP.Rules[0].Labels = map[string]string{"interface": "uplink"}
+	if err := CheckConfig(c); err == nil {
+		t.Error("expected an error but got nil")
+	}
+}
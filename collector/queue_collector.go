@@ -0,0 +1,153 @@
+package collector
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// queueMetrics are the properties of simple queues and queue tree entries
+// collected as metrics, with their help texts.
+var queueMetrics = []struct {
+	property  string
+	help      string
+	valueType prometheus.ValueType
+}{
+	{"bytes", "number of bytes passed through the queue", prometheus.CounterValue},
+	{"packets", "number of packets passed through the queue", prometheus.CounterValue},
+	{"dropped", "number of packets dropped by the queue", prometheus.CounterValue},
+	{"queued-bytes", "number of bytes waiting in the queue", prometheus.GaugeValue},
+	{"queued-packets", "number of packets waiting in the queue", prometheus.GaugeValue},
+	{"rate", "current rate of the queue in bits per second", prometheus.GaugeValue},
+}
+
+type queueCollector struct {
+	simpleProps        []string
+	treeProps          []string
+	simpleDescriptions map[string]*prometheus.Desc
+	treeDescriptions   map[string]*prometheus.Desc
+}
+
+func init() {
+	registerCollector(collectorFactory{
+		name:         "queue",
+		newCollector: newQueueCollector,
+		description:  "simple queue and queue tree traffic",
+	})
+}
+
+func newQueueCollector() routerOSCollector {
+	c := &queueCollector{}
+	c.init()
+	return c
+}
+
+func (c *queueCollector) init() {
+	c.simpleProps = []string{"name", "target", "parent"}
+	c.treeProps = []string{"name", "parent"}
+
+	c.simpleDescriptions = make(map[string]*prometheus.Desc)
+	c.treeDescriptions = make(map[string]*prometheus.Desc)
+	for _, m := range queueMetrics {
+		c.simpleProps = append(c.simpleProps, m.property)
+		c.treeProps = append(c.treeProps, m.property)
+
+		c.simpleDescriptions[m.property] = description("queue_simple", m.property, m.help, []string{"name", "target", "parent", "direction"})
+		c.treeDescriptions[m.property] = description("queue_tree", m.property, m.help, []string{"name", "parent"})
+	}
+}
+
+func (c *queueCollector) describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.simpleDescriptions {
+		ch <- d
+	}
+	for _, d := range c.treeDescriptions {
+		ch <- d
+	}
+}
+
+func (c *queueCollector) collect(ctx *collectorContext) error {
+	simple, err := c.fetch(ctx, "/queue/simple/print", c.simpleProps)
+	if err != nil {
+		return err
+	}
+	for _, re := range simple {
+		c.collectForSimpleQueue(ctx, re)
+	}
+
+	tree, err := c.fetch(ctx, "/queue/tree/print", c.treeProps)
+	if err != nil {
+		return err
+	}
+	for _, re := range tree {
+		c.collectForTreeQueue(ctx, re)
+	}
+
+	return nil
+}
+
+func (c *queueCollector) fetch(ctx *collectorContext, command string, props []string) ([]*proto.Sentence, error) {
+	reply, err := ctx.Run(command, "?disabled=false", "=.proplist="+strings.Join(props, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Re, nil
+}
+
+func (c *queueCollector) collectForSimpleQueue(ctx *collectorContext, re *proto.Sentence) {
+	name := re.Map["name"]
+	target := re.Map["target"]
+	parent := re.Map["parent"]
+
+	for _, m := range queueMetrics {
+		value := re.Map[m.property]
+		if value == "" {
+			continue
+		}
+
+		upload, download, err := splitPairToFloats(value)
+		if err != nil {
+			ctx.log.Error(
+				"error parsing queue metric value",
+				"queue", name,
+				"property", m.property,
+				"value", value,
+				"err", err,
+			)
+			continue
+		}
+
+		desc := c.simpleDescriptions[m.property]
+		ctx.ch <- prometheus.MustNewConstMetric(desc, m.valueType, upload, name, target, parent, "upload")
+		ctx.ch <- prometheus.MustNewConstMetric(desc, m.valueType, download, name, target, parent, "download")
+	}
+}
+
+func (c *queueCollector) collectForTreeQueue(ctx *collectorContext, re *proto.Sentence) {
+	name := re.Map["name"]
+	parent := re.Map["parent"]
+
+	for _, m := range queueMetrics {
+		value := re.Map[m.property]
+		if value == "" {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			ctx.log.Error(
+				"error parsing queue metric value",
+				"queue", name,
+				"property", m.property,
+				"value", value,
+				"err", err,
+			)
+			continue
+		}
+
+		ctx.ch <- prometheus.MustNewConstMetric(c.treeDescriptions[m.property], m.valueType, v, name, parent)
+	}
+}
@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"mikrotik-exporter/config"
+)
+
+// collectorFactory describes a collector that can be enabled in the features
+// of a module.
+type collectorFactory struct {
+	// name of the feature enabling the collector
+	name         string
+	newCollector func() routerOSCollector
+	description  string
+	// whether the collector runs for modules without features
+	defaultEnabled bool
+	// minimum RouterOS version the collector works with, empty if any. The
+	// collector is skipped on older devices.
+	minVersion string
+}
+
+var collectorFactories = map[string]collectorFactory{}
+
+// registerCollector makes a collector available to modules. It is called from
+// the init functions of the collectors.
+func registerCollector(f collectorFactory) {
+	if _, ok := collectorFactories[f.name]; ok {
+		panic(fmt.Sprintf("collector %s registered twice", f.name))
+	}
+	if f.minVersion != "" {
+		if _, _, err := parseVersion(f.minVersion); err != nil {
+			panic(fmt.Sprintf("collector %s: %v", f.name, err))
+		}
+	}
+	collectorFactories[f.name] = f
+}
+
+// collectorNames returns the names of all registered collectors, sorted.
+func collectorNames() []string {
+	names := make([]string, 0, len(collectorFactories))
+	for name := range collectorFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// collectorList returns the collectors enabled by f, sorted by name. If f is
+// nil, the collectors enabled by default are returned.
+func collectorList(f config.Features) ([]namedCollector, error) {
+	var names []string
+	if f == nil {
+		for _, name := range collectorNames() {
+			if collectorFactories[name].defaultEnabled {
+				names = append(names, name)
+			}
+		}
+	} else {
+		names = f.Enabled()
+	}
+
+	c := make([]namedCollector, 0, len(names))
+	for _, name := range names {
+		factory, ok := collectorFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+		c = append(c, namedCollector{name, factory.newCollector()})
+	}
+
+	return c, nil
+}
+
+// PrintCollectors writes the available collectors and the metrics they emit
+// to w.
+func PrintCollectors(w io.Writer) error {
+	for _, name := range collectorNames() {
+		f := collectorFactories[name]
+
+		var notes []string
+		if f.defaultEnabled {
+			notes = append(notes, "enabled by default")
+		}
+		if f.minVersion != "" {
+			notes = append(notes, "RouterOS "+f.minVersion+" or later")
+		}
+		line := fmt.Sprintf("%s: %s", f.name, f.description)
+		if len(notes) > 0 {
+			line += " (" + strings.Join(notes, ", ") + ")"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+
+		for _, metric := range describedMetrics(f.newCollector()) {
+			if _, err := fmt.Fprintf(w, "  %s\n", metric); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// describedMetrics returns the sorted names of the metrics described by co.
+func describedMetrics(co routerOSCollector) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, d := range describedDescs(co) {
+		if seen[d.name] {
+			continue
+		}
+		seen[d.name] = true
+		names = append(names, d.name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mikrotik-exporter/config"
+)
+
+func TestCollectorList(t *testing.T) {
+	testCases := []struct {
+		name     string
+		features config.Features
+		expected []string
+		hasError bool
+	}{
+		{"defaults", nil, []string{"info", "interface", "resource"}, false},
+		{"none", config.Features{}, []string{}, false},
+		{"enabled", config.Features{"routes": true, "bgp": true, "lte": false}, []string{"bgp", "routes"}, false},
+		{"unknown", config.Features{"bgp": true, "ospfv4": true}, nil, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			collectors, err := collectorList(testCase.features)
+			if testCase.hasError {
+				if err == nil {
+					t.Fatalf("expected an error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			names := []string{}
+			for _, co := range collectors {
+				names = append(names, co.name)
+			}
+			if strings.Join(names, ",") != strings.Join(testCase.expected, ",") {
+				t.Errorf("expected %v, got %v", testCase.expected, names)
+			}
+		})
+	}
+}
+
+func TestPrintCollectors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := PrintCollectors(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []string{
+		"resource: CPU, memory, disk and uptime (enabled by default)\n",
+		"  mikrotik_system_cpu_load\n",
+		"conntrack: connection tracking table size\n  mikrotik_conntrack_entries\n  mikrotik_conntrack_max_entries\n",
+	} {
+		if !strings.Contains(buf.String(), e) {
+			t.Errorf("expected %q in:\n%s", e, buf.String())
+		}
+	}
+}
@@ -22,6 +22,15 @@ type resourceCollector struct {
 	descriptions map[string]*prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:           "resource",
+		newCollector:   newResourceCollector,
+		description:    "CPU, memory, disk and uptime",
+		defaultEnabled: true,
+	})
+}
+
 func newResourceCollector() routerOSCollector {
 	c := &resourceCollector{}
 	c.init()
@@ -8,3 +8,9 @@ type routerOSCollector interface {
 	describe(ch chan<- *prometheus.Desc)
 	collect(ctx *collectorContext) error
 }
+
+// namedCollector is a routerOSCollector along with the feature name it was enabled by.
+type namedCollector struct {
+	name string
+	routerOSCollector
+}
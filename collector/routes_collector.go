@@ -1,16 +1,43 @@
 package collector
 
 import (
-	"fmt"
-	"strconv"
+	"sort"
+	"strings"
 
+	"github.com/go-routeros/routeros/v3/proto"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// mainRoutingTable is the table of routes without a routing mark or table.
+const mainRoutingTable = "main"
+
 type routesCollector struct {
 	protocols         []string
 	countDesc         *prometheus.Desc
 	countProtocolDesc *prometheus.Desc
+	activeDesc        *prometheus.Desc
+	inactiveDesc      *prometheus.Desc
+	ecmpDesc          *prometheus.Desc
+	defaultRouteDesc  *prometheus.Desc
+}
+
+// routeCounts are the counts of the routes in one routing table.
+type routeCounts struct {
+	total     float64
+	active    float64
+	ecmp      float64
+	protocols map[string]float64
+	// destinations of the ECMP routes counted on RouterOS 7
+	ecmpDsts     map[string]bool
+	defaultRoute bool
+}
+
+func init() {
+	registerCollector(collectorFactory{
+		name:         "routes",
+		newCollector: newRoutesCollector,
+		description:  "route counts by routing table, protocol and state",
+	})
 }
 
 func newRoutesCollector() routerOSCollector {
@@ -21,9 +48,13 @@ func newRoutesCollector() routerOSCollector {
 
 func (c *routesCollector) init() {
 	const prefix = "routes"
-	labelNames := []string{"ip_version"}
+	labelNames := []string{"ip_version", "routing_table"}
 	c.countDesc = description(prefix, "total_count", "number of routes in RIB", labelNames)
 	c.countProtocolDesc = description(prefix, "protocol_count", "number of routes per protocol in RIB", append(labelNames, "protocol"))
+	c.activeDesc = description(prefix, "active_count", "number of active routes in RIB", labelNames)
+	c.inactiveDesc = description(prefix, "inactive_count", "number of inactive routes in RIB", labelNames)
+	c.ecmpDesc = description(prefix, "ecmp_count", "number of routes with more than one gateway in RIB", labelNames)
+	c.defaultRouteDesc = description(prefix, "default_route", "whether the routing table has an active default route", labelNames)
 
 	c.protocols = []string{"bgp", "static", "ospf", "dynamic", "connect", "rip"}
 }
@@ -31,86 +62,135 @@ func (c *routesCollector) init() {
 func (c *routesCollector) describe(ch chan<- *prometheus.Desc) {
 	ch <- c.countDesc
 	ch <- c.countProtocolDesc
+	ch <- c.activeDesc
+	ch <- c.inactiveDesc
+	ch <- c.ecmpDesc
+	ch <- c.defaultRouteDesc
 }
 
 func (c *routesCollector) collect(ctx *collectorContext) error {
-	err := c.colllectForIPVersion(ctx, "4", "ip")
+	major, err := ctx.majorVersion()
 	if err != nil {
 		return err
 	}
 
-	return c.colllectForIPVersion(ctx, "6", "ip")
-}
-
-func (c *routesCollector) colllectForIPVersion(ctx *collectorContext, ipVersion, topic string) error {
-	err := c.colllectCount(ctx, ipVersion, topic)
+	err = c.collectForIPVersion(ctx, "4", "ip", major)
 	if err != nil {
 		return err
 	}
 
-	for _, p := range c.protocols {
-		err := c.colllectCountProtcol(ctx, ipVersion, topic, p)
-		if err != nil {
-			return err
-		}
+	err = c.collectForIPVersion(ctx, "6", "ipv6", major)
+	if isNoSuchCommand(err) {
+		ctx.log.Debug("no ipv6 routes, the ipv6 package is disabled", "err", err)
+		return nil
 	}
 
-	return nil
+	return err
 }
 
-func (c *routesCollector) colllectCount(ctx *collectorContext, ipVersion, topic string) error {
-	reply, err := ctx.client.Run(fmt.Sprintf("/%s/route/print", topic), "?disabled=false", "=count-only=")
+func (c *routesCollector) collectForIPVersion(ctx *collectorContext, ipVersion, topic string, major int) error {
+	routes, err := c.fetch(ctx, topic, major)
 	if err != nil {
-		ctx.log.Error(
-			"error fetching routes metrics",
-			"ip_version", ipVersion,
-			"topic", topic,
-			"err", err,
-		)
 		return err
 	}
-	if reply.Done.Map["ret"] == "" {
-		return nil
+
+	tables := map[string]*routeCounts{
+		mainRoutingTable: {protocols: map[string]float64{}},
 	}
-	v, err := strconv.ParseFloat(reply.Done.Map["ret"], 32)
-	if err != nil {
-		ctx.log.Error(
-			"error parsing routes metrics",
-			"ip_version", ipVersion,
-			"err", err,
-		)
-		return err
+	for _, re := range routes {
+		table := re.Map["routing-table"]
+		if major < 7 {
+			table = re.Map["routing-mark"]
+		}
+		if table == "" {
+			table = mainRoutingTable
+		}
+
+		counts, ok := tables[table]
+		if !ok {
+			counts = &routeCounts{protocols: map[string]float64{}}
+			tables[table] = counts
+		}
+		c.count(counts, re, major)
+	}
+
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, table := range names {
+		c.collectForTable(ctx, ipVersion, table, tables[table])
 	}
 
-	ctx.ch <- prometheus.MustNewConstMetric(c.countDesc, prometheus.GaugeValue, v, ipVersion)
 	return nil
 }
 
-func (c *routesCollector) colllectCountProtcol(ctx *collectorContext, ipVersion, topic, protocol string) error {
-	reply, err := ctx.client.Run(fmt.Sprintf("/%s/route/print", topic), "?disabled=false", fmt.Sprintf("?%s", protocol), "=count-only=")
+func (c *routesCollector) fetch(ctx *collectorContext, topic string, major int) ([]*proto.Sentence, error) {
+	props := []string{"dst-address", "active", "gateway"}
+	if major < 7 {
+		props = append(props, "routing-mark")
+	} else {
+		props = append(props, "routing-table", "ecmp")
+	}
+	props = append(props, c.protocols...)
+
+	reply, err := ctx.Run("/"+topic+"/route/print", "?disabled=false", "=.proplist="+strings.Join(props, ","))
 	if err != nil {
-		ctx.log.Error(
-			"error fetching routes metrics",
-			"ip_version", ipVersion,
-			"protocol", protocol,
-			"err", err,
-		)
-		return err
+		return nil, err
 	}
-	if reply.Done.Map["ret"] == "" {
-		return nil
+
+	return reply.Re, nil
+}
+
+func (c *routesCollector) count(counts *routeCounts, re *proto.Sentence, major int) {
+	counts.total++
+
+	dst := re.Map["dst-address"]
+	active := re.Map["active"] == "true"
+	if active {
+		counts.active++
+		if dst == "0.0.0.0/0" || dst == "::/0" {
+			counts.defaultRoute = true
+		}
 	}
-	v, err := strconv.ParseFloat(reply.Done.Map["ret"], 32)
-	if err != nil {
-		ctx.log.Error(
-			"error parsing routes metrics",
-			"ip_version", ipVersion,
-			"protocol", protocol,
-			"err", err,
-		)
-		return err
+
+	// RouterOS 6 lists one route with the gateways separated by commas,
+	// RouterOS 7 lists every path of an ECMP route and flags them, so their
+	// destinations are counted once
+	if major < 7 {
+		if strings.Contains(re.Map["gateway"], ",") {
+			counts.ecmp++
+		}
+	} else if re.Map["ecmp"] == "true" && !counts.ecmpDsts[dst] {
+		if counts.ecmpDsts == nil {
+			counts.ecmpDsts = map[string]bool{}
+		}
+		counts.ecmpDsts[dst] = true
+		counts.ecmp++
 	}
 
-	ctx.ch <- prometheus.MustNewConstMetric(c.countProtocolDesc, prometheus.GaugeValue, v, ipVersion, protocol)
-	return nil
+	for _, p := range c.protocols {
+		if re.Map[p] == "true" {
+			counts.protocols[p]++
+		}
+	}
+}
+
+func (c *routesCollector) collectForTable(ctx *collectorContext, ipVersion, table string, counts *routeCounts) {
+	ctx.ch <- prometheus.MustNewConstMetric(c.countDesc, prometheus.GaugeValue, counts.total, ipVersion, table)
+	ctx.ch <- prometheus.MustNewConstMetric(c.activeDesc, prometheus.GaugeValue, counts.active, ipVersion, table)
+	ctx.ch <- prometheus.MustNewConstMetric(c.inactiveDesc, prometheus.GaugeValue, counts.total-counts.active, ipVersion, table)
+	ctx.ch <- prometheus.MustNewConstMetric(c.ecmpDesc, prometheus.GaugeValue, counts.ecmp, ipVersion, table)
+
+	defaultRoute := 0.0
+	if counts.defaultRoute {
+		defaultRoute = 1
+	}
+	ctx.ch <- prometheus.MustNewConstMetric(c.defaultRouteDesc, prometheus.GaugeValue, defaultRoute, ipVersion, table)
+
+	for _, p := range c.protocols {
+		ctx.ch <- prometheus.MustNewConstMetric(c.countProtocolDesc, prometheus.GaugeValue, counts.protocols[p], ipVersion, table, p)
+	}
 }
@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	labelMetricsPath = "__metrics_path__"
+	labelParamTarget = "__param_" + paramTarget
+	labelParamModule = "__param_" + paramModule
+	labelInstance    = "instance"
+)
+
+// targetGroup is a target group of the Prometheus HTTP service discovery.
+// https://prometheus.io/docs/prometheus/latest/http_sd/
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// SDHandler returns a handler serving the configured and discovered targets
+// and SRV groups of p for the Prometheus HTTP service discovery. Every group
+// points at the exporter itself at externalAddress, so the scrape config only
+// needs honor_labels to keep the target labels which are also added by /probe.
+// If externalAddress is empty, the Host header of the request is used, which is
+// only right if Prometheus reaches the exporter directly.
+func (p *Prober) SDHandler(externalAddress string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exporter := externalAddress
+		if exporter == "" {
+			exporter = r.Host
+		}
+
+		b, err := json.Marshal(p.targetGroups(exporter))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(b); err != nil {
+			slog.Error("error writing service discovery response", "err", err)
+		}
+	})
+}
+
+// targetGroups returns a group for every target and SRV group of p, including
+// those discovered through MNDP, sorted by name. exporter is the address
+// Prometheus reaches the exporter at.
+func (p *Prober) targetGroups(exporter string) []targetGroup {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	type entry struct {
+		module string
+		labels prometheus.Labels
+	}
+	entries := map[string]entry{}
+	if p.mndp != nil {
+		for name, t := range p.mndp.targets(p.modules, time.Now()) {
+			entries[name] = entry{t.module, t.labels}
+		}
+	}
+	// configured targets take precedence over discovered ones
+	for name, t := range p.targets {
+		entries[name] = entry{t.module, t.labels}
+	}
+	for name, g := range p.groups {
+		entries[name] = entry{g.module, g.labels}
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groups := make([]targetGroup, 0, len(names))
+	for _, name := range names {
+		e := entries[name]
+
+		labels := make(map[string]string, len(e.labels)+4)
+		for k, v := range e.labels {
+			labels[k] = v
+		}
+		labels[labelMetricsPath] = "/probe"
+		labels[labelParamTarget] = name
+		labels[labelParamModule] = e.module
+		labels[labelInstance] = name
+
+		groups = append(groups, targetGroup{
+			Targets: []string{exporter},
+			Labels:  labels,
+		})
+	}
+
+	return groups
+}
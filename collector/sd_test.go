@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mikrotik-exporter/config"
+)
+
+func TestSDHandler(t *testing.T) {
+	p, err := NewProber(&config.Config{
+		Modules: map[string]config.Module{
+			"default": {Username: "prometheus", Password: "changeme"},
+			"lte":     {Username: "prometheus", Password: "changeme"},
+		},
+		Targets: map[string]config.Target{
+			"edge-rtr-1": {Address: "192.0.2.2:8728", Module: "lte"},
+			"core-rtr-1": {Address: "192.0.2.1:8728", Module: "default", Labels: map[string]string{"site": "dc1"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "http://exporter:9436/sd", nil)
+	w := httptest.NewRecorder()
+	p.SDHandler("").ServeHTTP(w, r)
+
+	expected := `[` +
+		`{"targets":["exporter:9436"],"labels":{"__metrics_path__":"/probe","__param_module":"default","__param_target":"core-rtr-1","instance":"core-rtr-1","site":"dc1"}},` +
+		`{"targets":["exporter:9436"],"labels":{"__metrics_path__":"/probe","__param_module":"lte","__param_target":"edge-rtr-1","instance":"edge-rtr-1"}}` +
+		`]`
+	if w.Body.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected content type application/json, got %s", ct)
+	}
+
+	// the external address wins over the Host header
+	w = httptest.NewRecorder()
+	p.SDHandler("mikrotik-exporter.example.com:443").ServeHTTP(w, r)
+	if !strings.HasPrefix(w.Body.String(), `[{"targets":["mikrotik-exporter.example.com:443"]`) {
+		t.Errorf("expected the external address in:\n%s", w.Body)
+	}
+}
@@ -0,0 +1,269 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	labelAddress = "address"
+
+	// srvMinTTL is the shortest time records are cached for, so that a zero
+	// TTL does not make refresh query the resolvers continuously.
+	srvMinTTL = 30 * time.Second
+	// srvRetryInterval is the time to wait before retrying a failed lookup.
+	srvRetryInterval = 30 * time.Second
+	// srvLookupTimeout bounds a background lookup.
+	srvLookupTimeout = 10 * time.Second
+
+	resolvConf = "/etc/resolv.conf"
+)
+
+// srvGroup is a group of devices discovered through a DNS SRV record. The
+// record is resolved in the background by refresh, probes only read the cache.
+type srvGroup struct {
+	record    string
+	resolvers []string
+	module    string
+	c         *collector
+	labels    prometheus.Labels
+
+	mu sync.Mutex
+	// addresses of the devices from the last successful lookup, nil if no
+	// lookup succeeded yet
+	devices []string
+	// error of the last lookup
+	err error
+}
+
+// cached returns the addresses of the devices in g from the last successful
+// lookup. It never resolves the record, so a probe is not held up by DNS.
+func (g *srvGroup) cached() ([]string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.devices != nil {
+		return g.devices, nil
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+	return nil, errors.New("record not resolved yet")
+}
+
+// resolve looks up the record of g and caches the addresses of its devices.
+// It returns how long to wait before resolving it again: the TTL of the
+// records, or srvRetryInterval if the lookup failed, in which case the
+// addresses of the last successful lookup are kept.
+func (g *srvGroup) resolve(ctx context.Context) (time.Duration, error) {
+	records, ttl, err := lookupSRV(ctx, g.resolvers, g.record)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.err = err
+	if err != nil {
+		return srvRetryInterval, err
+	}
+
+	devices := make([]string, 0, len(records))
+	for _, r := range records {
+		devices = append(devices, net.JoinHostPort(r.target, strconv.Itoa(int(r.port))))
+	}
+	sort.Strings(devices)
+	g.devices = devices
+
+	return max(ttl, srvMinTTL), nil
+}
+
+// refresh keeps the cache of g warm by resolving the record whenever it
+// expires. It returns when ctx is done.
+func (g *srvGroup) refresh(ctx context.Context) {
+	for {
+		lookupCtx, cancel := context.WithTimeout(ctx, srvLookupTimeout)
+		wait, err := g.resolve(lookupCtx)
+		cancel()
+
+		if err != nil && ctx.Err() == nil {
+			slog.Error("srv lookup failed", "record", g.record, "retry", wait, "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+type srvRecord struct {
+	target string
+	port   uint16
+}
+
+// lookupSRV queries the resolvers in turn for the SRV records of name. It
+// returns the records and the smallest TTL among them.
+func lookupSRV(ctx context.Context, resolvers []string, name string) ([]srvRecord, time.Duration, error) {
+	if len(resolvers) == 0 {
+		return nil, 0, errors.New("no resolvers")
+	}
+
+	var errs []error
+	for _, resolver := range resolvers {
+		records, ttl, err := querySRV(ctx, resolver, name)
+		if err == nil {
+			return records, ttl, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", resolver, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, 0, errors.Join(errs...)
+}
+
+func querySRV(ctx context.Context, resolver, name string) ([]srvRecord, time.Duration, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid name: %w", err)
+	}
+
+	id := uint16(rand.Uint32())
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: n, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, 0, fmt.Errorf("pack: %w", err)
+	}
+
+	resp, err := exchange(ctx, "udp", resolver, query)
+	if err == nil && resp.Truncated {
+		resp, err = exchange(ctx, "tcp", resolver, query)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.ID != id {
+		return nil, 0, errors.New("response id mismatch")
+	}
+	if resp.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, fmt.Errorf("lookup %s: %s", name, resp.RCode)
+	}
+
+	records := []srvRecord{}
+	var ttl uint32
+	for _, a := range resp.Answers {
+		srv, ok := a.Body.(*dnsmessage.SRVResource)
+		if !ok {
+			continue
+		}
+		if len(records) == 0 || a.Header.TTL < ttl {
+			ttl = a.Header.TTL
+		}
+		records = append(records, srvRecord{
+			target: strings.TrimSuffix(srv.Target.String(), "."),
+			port:   srv.Port,
+		})
+	}
+
+	return records, time.Duration(ttl) * time.Second, nil
+}
+
+// exchange sends query to resolver over network and returns the response.
+func exchange(ctx context.Context, network, resolver string, query []byte) (*dnsmessage.Message, error) {
+	conn, err := new(net.Dialer).DialContext(ctx, network, resolver)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(srvLookupTimeout)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	var b []byte
+	if network == "tcp" {
+		// messages are prefixed with their length over TCP
+		msg := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(query)), uint16(len(query)))
+		if _, err := conn.Write(append(msg, query...)); err != nil {
+			return nil, fmt.Errorf("write: %w", err)
+		}
+
+		var l [2]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return nil, fmt.Errorf("read: %w", err)
+		}
+		b = make([]byte, binary.BigEndian.Uint16(l[:]))
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return nil, fmt.Errorf("read: %w", err)
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, fmt.Errorf("write: %w", err)
+		}
+
+		b = make([]byte, 65535)
+		n, err := conn.Read(b)
+		if err != nil {
+			return nil, fmt.Errorf("read: %w", err)
+		}
+		b = b[:n]
+	}
+
+	msg := &dnsmessage.Message{}
+	if err := msg.Unpack(b); err != nil {
+		return nil, fmt.Errorf("unpack: %w", err)
+	}
+
+	return msg, nil
+}
+
+// systemResolvers returns the nameservers of /etc/resolv.conf.
+func systemResolvers() ([]string, error) {
+	f, err := os.Open(resolvConf)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	resolvers := []string{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			resolvers = append(resolvers, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(resolvers) == 0 {
+		return nil, fmt.Errorf("no nameservers in %s", resolvConf)
+	}
+
+	return resolvers, nil
+}
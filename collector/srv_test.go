@@ -0,0 +1,226 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mikrotik-exporter/config"
+	"mikrotik-exporter/internal/routerostest"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsStub is a DNS server answering SRV queries from records.
+type dnsStub struct {
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	records map[string][]net.SRV
+	ttl     uint32
+	queries int
+}
+
+func newDNSStub(t *testing.T, records map[string][]net.SRV, ttl uint32) *dnsStub {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &dnsStub{conn: conn, records: records, ttl: ttl}
+	go s.serve()
+
+	return s
+}
+
+func (s *dnsStub) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+func (s *dnsStub) queryCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queries
+}
+
+func (s *dnsStub) setRecords(records map[string][]net.SRV) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = records
+}
+
+func (s *dnsStub) serve() {
+	b := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+
+		var query dnsmessage.Message
+		if err := query.Unpack(b[:n]); err != nil || len(query.Questions) != 1 {
+			continue
+		}
+		q := query.Questions[0]
+
+		s.mu.Lock()
+		s.queries++
+		records, ok := s.records[q.Name.String()]
+		s.mu.Unlock()
+
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true},
+			Questions: query.Questions,
+		}
+		if !ok {
+			resp.RCode = dnsmessage.RCodeNameError
+		}
+		for _, r := range records {
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: s.ttl},
+				Body: &dnsmessage.SRVResource{
+					Priority: r.Priority,
+					Weight:   r.Weight,
+					Port:     r.Port,
+					Target:   dnsmessage.MustNewName(r.Target),
+				},
+			})
+		}
+
+		out, err := resp.Pack()
+		if err != nil {
+			continue
+		}
+		_, _ = s.conn.WriteTo(out, addr)
+	}
+}
+
+func TestSRVGroupResolve(t *testing.T) {
+	stub := newDNSStub(t, map[string][]net.SRV{
+		"_mikrotik._tcp.example.com.": {
+			{Target: "rtr2.example.com.", Port: 8729},
+			{Target: "rtr1.example.com.", Port: 8728},
+		},
+	}, 300)
+
+	g := &srvGroup{
+		record:    "_mikrotik._tcp.example.com",
+		resolvers: []string{stub.addr()},
+	}
+
+	if _, err := g.cached(); err == nil {
+		t.Fatal("expected an error before the first lookup but got nil")
+	}
+
+	expected := []string{"rtr1.example.com:8728", "rtr2.example.com:8729"}
+	wait, err := g.resolve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait != 300*time.Second {
+		t.Errorf("expected the record to be cached for its TTL, got %s", wait)
+	}
+	devices, err := g.cached()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(devices, expected) {
+		t.Fatalf("expected %v, got %v", expected, devices)
+	}
+	if q := stub.queryCount(); q != 1 {
+		t.Errorf("expected reading the cache not to query, got %d queries", q)
+	}
+
+	// failed lookups are retried later and keep the cached devices
+	stub.setRecords(nil)
+	wait, err = g.resolve(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "NameError") {
+		t.Errorf("expected a NameError, got %v", err)
+	}
+	if wait != srvRetryInterval {
+		t.Errorf("expected a retry after %s, got %s", srvRetryInterval, wait)
+	}
+	devices, err = g.cached()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(devices, expected) {
+		t.Fatalf("expected %v, got %v", expected, devices)
+	}
+}
+
+func TestSRVGroupResolveError(t *testing.T) {
+	stub := newDNSStub(t, nil, 300)
+
+	g := &srvGroup{
+		record:    "_mikrotik._tcp.example.com",
+		resolvers: []string{stub.addr()},
+	}
+
+	_, _ = g.resolve(context.Background())
+	_, err := g.cached()
+	if err == nil || !strings.Contains(err.Error(), "NameError") {
+		t.Errorf("expected a NameError, got %v", err)
+	}
+}
+
+func TestProberSRVGroup(t *testing.T) {
+	replies, err := routerostest.LoadFile(filepath.Join("testdata", "v6", "resource.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := routerostest.NewServer(t, replies)
+	_, port, err := net.SplitHostPort(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+
+	stub := newDNSStub(t, map[string][]net.SRV{
+		"_mikrotik._tcp.example.com.": {{Target: "127.0.0.1.", Port: uint16(p)}},
+	}, 300)
+
+	prober, err := NewProber(&config.Config{
+		Modules: map[string]config.Module{
+			"default": {Username: "prometheus", Password: "changeme", Features: config.Features{"resource": true}},
+		},
+		SRVGroups: map[string]config.SRVGroup{
+			"branches": {
+				Record:   "_mikrotik._tcp.example.com",
+				Resolver: stub.addr(),
+				Module:   "default",
+				Labels:   map[string]string{"site": "branch"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(prober.Close)
+
+	// the record is resolved in the background
+	g, _ := prober.srvGroup("branches")
+	for _, err := g.cached(); err != nil; _, err = g.cached() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w := httptest.NewRecorder()
+	prober.ServeHTTP(w, httptest.NewRequest("GET", "/probe?target=branches", nil))
+
+	expected := `mikrotik_up{address="` + srv.Addr() + `",site="branch"} 1` + "\n"
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("expected %q in:\n%s", expected, w.Body)
+	}
+}
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// routerOSVersion holds the RouterOS version of the device for one scrape. It
+// is fetched once by the first collector asking for it.
+type routerOSVersion struct {
+	once  sync.Once
+	major int
+	minor int
+	err   error
+}
+
+func (v *routerOSVersion) load(ctx *collectorContext) {
+	reply, err := ctx.Run("/system/resource/print", "=.proplist=version")
+	if err != nil {
+		v.err = err
+		return
+	}
+	if len(reply.Re) == 0 {
+		v.err = fmt.Errorf("no version returned")
+		return
+	}
+
+	v.major, v.minor, v.err = parseVersion(reply.Re[0].Map["version"])
+}
+
+// parseVersion returns the major and minor version of a RouterOS version such
+// as "7.16.2 (stable)" or "7.1".
+func parseVersion(version string) (int, int, error) {
+	version, _, _ = strings.Cut(version, " ")
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid RouterOS version %q", version)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid RouterOS version %q", version)
+	}
+	// pre-releases such as 7.1beta2 count as their minor version
+	i := strings.IndexFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(parts[1])
+	}
+	minor, err := strconv.Atoi(parts[1][:i])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid RouterOS version %q", version)
+	}
+
+	return major, minor, nil
+}
+
+// majorVersion returns the major RouterOS version of the device, for collectors
+// querying menus that changed between versions.
+func (c *collectorContext) majorVersion() (int, error) {
+	v, err := c.loadVersion()
+	if err != nil {
+		return 0, err
+	}
+
+	return v.major, nil
+}
+
+// versionAtLeast returns whether the device runs RouterOS major.minor or later.
+func (c *collectorContext) versionAtLeast(major, minor int) (bool, error) {
+	v, err := c.loadVersion()
+	if err != nil {
+		return false, err
+	}
+
+	return v.major > major || (v.major == major && v.minor >= minor), nil
+}
+
+func (c *collectorContext) loadVersion() (*routerOSVersion, error) {
+	v := c.version
+	if v == nil {
+		v = &routerOSVersion{}
+	}
+
+	v.once.Do(func() { v.load(c) })
+	if v.err != nil {
+		return nil, fmt.Errorf("routeros version: %w", v.err)
+	}
+
+	return v, nil
+}
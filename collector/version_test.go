@@ -0,0 +1,38 @@
+package collector
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	testCases := []struct {
+		input    string
+		major    int
+		minor    int
+		hasError bool
+	}{
+		{"7.16.2 (stable)", 7, 16, false},
+		{"6.49.10 (long-term)", 6, 49, false},
+		{"7.1", 7, 1, false},
+		{"7.1beta2 (testing)", 7, 1, false},
+		{"7", 0, 0, true},
+		{"seven.1", 0, 0, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.input, func(t *testing.T) {
+			major, minor, err := parseVersion(testCase.input)
+			if testCase.hasError {
+				if err == nil {
+					t.Fatalf("expected an error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			if major != testCase.major || minor != testCase.minor {
+				t.Errorf("expected %d.%d, got %d.%d", testCase.major, testCase.minor, major, minor)
+			}
+		})
+	}
+}
@@ -51,7 +51,7 @@ func (c *w60gInterfaceCollector) collect(ctx *collectorContext) error {
 }
 
 func (c *w60gInterfaceCollector) collectw60gMetricsForInterfaces(ctx *collectorContext, ifaces []string) error {
-	reply, err := ctx.client.Run("/interface/w60g/monitor",
+	reply, err := ctx.Run("/interface/w60g/monitor",
 		"=numbers="+strings.Join(ifaces, ","),
 		"=once=",
 		"=.proplist=name,"+strings.Join(c.props, ","))
@@ -98,6 +98,14 @@ func (c *w60gInterfaceCollector) collectMetricsForw60gInterface(ctx *collectorCo
 	}
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "w60g",
+		newCollector: neww60gInterfaceCollector,
+		description:  "60 GHz wireless link quality",
+	})
+}
+
 func neww60gInterfaceCollector() routerOSCollector {
 	const prefix = "w60ginterface"
 
@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type wireguardCollector struct {
+	peerProps         []string
+	interfaceProps    []string
+	rxDesc            *prometheus.Desc
+	txDesc            *prometheus.Desc
+	lastHandshakeDesc *prometheus.Desc
+	listenPortDesc    *prometheus.Desc
+	runningDesc       *prometheus.Desc
+}
+
+func init() {
+	registerCollector(collectorFactory{
+		name:         "wireguard",
+		newCollector: newWireguardCollector,
+		description:  "WireGuard interfaces and peer traffic and handshakes",
+		minVersion:   "7.1",
+	})
+}
+
+func newWireguardCollector() routerOSCollector {
+	c := &wireguardCollector{}
+	c.init()
+	return c
+}
+
+func (c *wireguardCollector) init() {
+	c.peerProps = []string{"interface", "public-key", "comment", "allowed-address", "rx", "tx", "last-handshake"}
+	c.interfaceProps = []string{"name", "listen-port", "running"}
+
+	const prefix = "wireguard"
+	peerLabelNames := []string{"interface", "public_key", "comment", "allowed_address"}
+	c.rxDesc = description(prefix, "peer_rx_bytes", "number of bytes received from the peer", peerLabelNames)
+	c.txDesc = description(prefix, "peer_tx_bytes", "number of bytes sent to the peer", peerLabelNames)
+	c.lastHandshakeDesc = description(prefix, "peer_last_handshake_seconds", "time since the last handshake with the peer", peerLabelNames)
+
+	interfaceLabelNames := []string{"interface"}
+	c.listenPortDesc = description(prefix, "interface_listen_port", "UDP port the WireGuard interface listens on", interfaceLabelNames)
+	c.runningDesc = description(prefix, "interface_running", "whether the WireGuard interface is running", interfaceLabelNames)
+}
+
+func (c *wireguardCollector) describe(ch chan<- *prometheus.Desc) {
+	ch <- c.rxDesc
+	ch <- c.txDesc
+	ch <- c.lastHandshakeDesc
+	ch <- c.listenPortDesc
+	ch <- c.runningDesc
+}
+
+func (c *wireguardCollector) collect(ctx *collectorContext) error {
+	interfaces, err := c.fetch(ctx, "/interface/wireguard/print", c.interfaceProps)
+	if err != nil {
+		return err
+	}
+	for _, re := range interfaces {
+		c.collectForInterface(ctx, re)
+	}
+
+	peers, err := c.fetch(ctx, "/interface/wireguard/peers/print", c.peerProps)
+	if err != nil {
+		return err
+	}
+	for _, re := range peers {
+		c.collectForPeer(ctx, re)
+	}
+
+	return nil
+}
+
+func (c *wireguardCollector) fetch(ctx *collectorContext, command string, props []string) ([]*proto.Sentence, error) {
+	reply, err := ctx.Run(command, "?disabled=false", "=.proplist="+strings.Join(props, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Re, nil
+}
+
+func (c *wireguardCollector) collectForInterface(ctx *collectorContext, re *proto.Sentence) {
+	name := re.Map["name"]
+
+	running := 0.0
+	if re.Map["running"] == "true" {
+		running = 1
+	}
+	ctx.ch <- prometheus.MustNewConstMetric(c.runningDesc, prometheus.GaugeValue, running, name)
+
+	if value := re.Map["listen-port"]; value != "" {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			ctx.log.Error(
+				"error parsing wireguard metric value",
+				"interface", name,
+				"property", "listen-port",
+				"value", value,
+				"err", err,
+			)
+			return
+		}
+		ctx.ch <- prometheus.MustNewConstMetric(c.listenPortDesc, prometheus.GaugeValue, v, name)
+	}
+}
+
+func (c *wireguardCollector) collectForPeer(ctx *collectorContext, re *proto.Sentence) {
+	labelValues := []string{re.Map["interface"], re.Map["public-key"], re.Map["comment"], re.Map["allowed-address"]}
+
+	for _, m := range []struct {
+		property  string
+		desc      *prometheus.Desc
+		valueType prometheus.ValueType
+	}{
+		{"rx", c.rxDesc, prometheus.CounterValue},
+		{"tx", c.txDesc, prometheus.CounterValue},
+		// peers that never completed a handshake have no last-handshake
+		{"last-handshake", c.lastHandshakeDesc, prometheus.GaugeValue},
+	} {
+		value := re.Map[m.property]
+		if value == "" {
+			continue
+		}
+
+		var v float64
+		var err error
+		if m.property == "last-handshake" {
+			v, err = parseDuration(value)
+		} else {
+			v, err = strconv.ParseFloat(value, 64)
+		}
+		if err != nil {
+			ctx.log.Error(
+				"error parsing wireguard metric value",
+				"public_key", re.Map["public-key"],
+				"property", m.property,
+				"value", value,
+				"err", err,
+			)
+			continue
+		}
+
+		ctx.ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, v, labelValues...)
+	}
+}
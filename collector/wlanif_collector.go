@@ -14,6 +14,14 @@ type wlanIFCollector struct {
 	descriptions map[string]*prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "wlanif",
+		newCollector: newWlanIFCollector,
+		description:  "wireless interface frequency and client counts",
+	})
+}
+
 func newWlanIFCollector() routerOSCollector {
 	c := &wlanIFCollector{}
 	c.init()
@@ -66,7 +74,7 @@ func (c *wlanIFCollector) fetchInterfaceNames(ctx *collectorContext) ([]string,
 }
 
 func (c *wlanIFCollector) collectForInterface(ctx *collectorContext, iface string) error {
-	reply, err := ctx.client.Run("/interface/wireless/monitor", fmt.Sprintf("=numbers=%s", iface), "=once=", "=.proplist="+strings.Join(c.props, ","))
+	reply, err := ctx.Run("/interface/wireless/monitor", fmt.Sprintf("=numbers=%s", iface), "=once=", "=.proplist="+strings.Join(c.props, ","))
 	if err != nil {
 		ctx.log.Error(
 			"error fetching interface statistics",
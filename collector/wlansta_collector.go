@@ -13,6 +13,14 @@ type wlanSTACollector struct {
 	descriptions map[string]*prometheus.Desc
 }
 
+func init() {
+	registerCollector(collectorFactory{
+		name:         "wlansta",
+		newCollector: newWlanSTACollector,
+		description:  "wireless client signal and traffic",
+	})
+}
+
 func newWlanSTACollector() routerOSCollector {
 	c := &wlanSTACollector{}
 	c.init()
@@ -1,8 +1,16 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/prometheus/common/model"
 	yaml "gopkg.in/yaml.v3"
 )
 
@@ -16,49 +24,286 @@ type Module struct {
 	TLS         bool `yaml:"tls"`
 	InsecureTLS bool `yaml:"insecure_tls"`
 
-	Timeout int `yaml:"timeout"`
+	Timeout Duration `yaml:"timeout"`
+
+	// Concurrency is the number of collectors run in parallel against a device.
+	// Collectors are multiplexed over one API session using tagged commands.
+	Concurrency int `yaml:"concurrency"`
 
 	Features Features `yaml:"features"`
 
+	// IdentityLabel adds the system identity of the device as the identity
+	// label to every metric of a probe. It costs one more command per probe.
+	IdentityLabel bool `yaml:"identity_label"`
+
+	// Interfaces selects the interfaces collected by interface-scoped collectors.
+	Interfaces InterfaceFilter `yaml:"interfaces"`
+
+	// Firewall configures the firewall collector.
+	Firewall Firewall `yaml:"firewall"`
+
+	// PPP configures the ppp collector.
+	PPP PPP `yaml:"ppp"`
+
+	// CustomCollectors are collectors defined in the config, keyed by name.
+	CustomCollectors map[string]CustomCollector `yaml:"custom_collectors"`
+
 	CAFile string `yaml:"ca_file"`
 }
 
-type Features struct {
-	BGP       bool `yaml:"bgp,omitempty"`
-	Conntrack bool `yaml:"conntrack,omitempty"`
-	Capsman   bool `yaml:"capsman,omitempty"`
-	DHCP      bool `yaml:"dhcp,omitempty"`
-	DHCPL     bool `yaml:"dhcpl,omitempty"`
-	DHCPv6    bool `yaml:"dhcpv6,omitempty"`
-	Firmware  bool `yaml:"firmware,omitempty"`
-	Health    bool `yaml:"health,omitempty"`
-	Lte       bool `yaml:"lte,omitempty"`
-	Interface bool `yaml:"interface,omitempty"`
-	Ipsec     bool `yaml:"ipsec,omitempty"`
-	Monitor   bool `yaml:"monitor,omitempty"`
-	Optics    bool `yaml:"optics,omitempty"`
-	POE       bool `yaml:"poe,omitempty"`
-	Pools     bool `yaml:"pools,omitempty"`
-	Resource  bool `yaml:"resource,omitempty"`
-	Routes    bool `yaml:"routes,omitempty"`
-	W60G      bool `yaml:"w60g,omitempty"`
-	WlanSTA   bool `yaml:"wlansta,omitempty"`
-	WlanIF    bool `yaml:"wlanif,omitempty"`
-	Netwatch  bool `yaml:"netwatch,omitempty"`
+// InterfaceFilter selects the interfaces collected by the interface, monitor,
+// optics and poe collectors. Interfaces must pass every condition that is set.
+type InterfaceFilter struct {
+	// Include and Exclude are regular expressions matched against the whole
+	// interface name.
+	Include string `yaml:"include"`
+	Exclude string `yaml:"exclude"`
+
+	// Types are interface types such as ether, vlan or pppoe-in.
+	Types        []string `yaml:"types"`
+	ExcludeTypes []string `yaml:"exclude_types"`
+
+	// Running and Disabled select interfaces by their state.
+	Running  *bool `yaml:"running"`
+	Disabled *bool `yaml:"disabled"`
+
+	// Comment and ExcludeComment are regular expressions matched against the
+	// whole comment.
+	Comment        string `yaml:"comment"`
+	ExcludeComment string `yaml:"exclude_comment"`
+}
+
+// Firewall configures how the firewall collector identifies and selects rules.
+type Firewall struct {
+	// Key is the rule property identifying a rule across reorders, for example
+	// comment. If empty, rules are identified by their position.
+	Key string `yaml:"key"`
+	// SkipDisabled and SkipDynamic leave disabled and dynamic rules out.
+	SkipDisabled bool `yaml:"skip_disabled"`
+	SkipDynamic  bool `yaml:"skip_dynamic"`
+}
+
+// PPP configures the ppp collector.
+type PPP struct {
+	// Sessions enables the metrics of every active session, one series per
+	// session and metric.
+	Sessions bool `yaml:"sessions"`
+}
+
+// CustomCollector collects metrics from the items printed by an API menu.
+type CustomCollector struct {
+	// Path is the API menu, for example /interface/vrrp. Its print command is run.
+	Path string `yaml:"path"`
+	// Query words filtering the items, for example ?disabled=false
+	Query []string `yaml:"query"`
+	// Labels are the properties added as labels to every metric of an item.
+	Labels []string `yaml:"labels"`
+	// Values are the properties collected as metrics.
+	Values []CustomValue `yaml:"values"`
+}
+
+// CustomValue is a property collected as the metric
+// mikrotik_custom_<collector>_<name>.
+type CustomValue struct {
+	Property string `yaml:"property"`
+	// Name of the metric, the property if empty
+	Name string `yaml:"name"`
+	Help string `yaml:"help"`
+	// Type is gauge or counter, gauge if empty.
+	Type string `yaml:"type"`
+
+	// Mapping maps property values such as up or down to metric values.
+	Mapping map[string]float64 `yaml:"mapping"`
+	// Conversion parses values that are not numbers. duration converts
+	// RouterOS durations such as 1d2h3m to seconds.
+	Conversion string `yaml:"conversion"`
+	// Scale multiplies values, for example 0.001 for milliseconds to seconds.
+	// Mapped values are not scaled.
+	Scale float64 `yaml:"scale"`
+}
+
+// Features are the names of the collectors enabled in a module. In YAML they
+// are either a list of names or a mapping of names to whether they are enabled.
+// A nil Features enables the collectors that are enabled by default.
+type Features map[string]bool
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (f *Features) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		var names []string
+		if err := node.Decode(&names); err != nil {
+			return err
+		}
+		*f = make(Features, len(names))
+		for _, name := range names {
+			(*f)[name] = true
+		}
+		return nil
+	case yaml.MappingNode:
+		m := map[string]bool{}
+		if err := node.Decode(&m); err != nil {
+			return err
+		}
+		*f = m
+		return nil
+	default:
+		return fmt.Errorf("line %d: features must be a list or a mapping", node.Line)
+	}
+}
+
+// Enabled returns the sorted names of the enabled features.
+func (f Features) Enabled() []string {
+	names := []string{}
+	for name, enabled := range f {
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Duration is a time.Duration that is unmarshaled from Prometheus or Go
+// duration strings such as 10s, 1m30s or 1.5s. Plain numbers are seconds.
+type Duration time.Duration
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	err := node.Decode(&s)
+	if err != nil {
+		return err
+	}
+
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		*d = Duration(secs * float64(time.Second))
+		return nil
+	}
+
+	if md, err := model.ParseDuration(s); err == nil {
+		*d = Duration(md)
+		return nil
+	}
+
+	td, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", node.Line, s)
+	}
+	*d = Duration(td)
+
+	return nil
+}
+
+// Target is a device that is probed by name instead of by address.
+type Target struct {
+	// Address is the host:port of the device's API service.
+	Address string `yaml:"address"`
+	Module  string `yaml:"module"`
+
+	// Credentials override those of the module when set.
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	UsernameFile string `yaml:"username_file"`
+	PasswordFile string `yaml:"password_file"`
+
+	// Labels are added to every metric of the target.
+	Labels map[string]string `yaml:"labels"`
+}
+
+// SRVGroup is a group of devices discovered through a DNS SRV record.
+type SRVGroup struct {
+	Record string `yaml:"record"`
+	// Resolver is the host[:port] of the DNS server to query. The nameservers
+	// of /etc/resolv.conf are used if empty.
+	Resolver string `yaml:"resolver"`
+	Module   string `yaml:"module"`
+
+	// Labels are added to every metric of the devices in the group.
+	Labels map[string]string `yaml:"labels"`
+}
+
+// MNDP configures the discovery of devices through the MikroTik Neighbor
+// Discovery Protocol.
+type MNDP struct {
+	// Listen is the UDP address to receive MNDP packets on, :5678 if empty.
+	Listen string `yaml:"listen"`
+	// Port is the API port of discovered devices, 8728 if zero.
+	Port int `yaml:"port"`
+	// Expire is the time after which a device that was not seen anymore is
+	// forgotten, 5m if zero.
+	Expire Duration `yaml:"expire"`
+
+	// Rules map discovered devices to modules. The first matching rule is
+	// used, devices matching no rule are not probed.
+	Rules []MNDPRule `yaml:"rules"`
+}
+
+// MNDPRule matches discovered devices. A rule without conditions matches every
+// device.
+type MNDPRule struct {
+	Module string `yaml:"module"`
+
+	// Board is the exact board name, for example RB4011iGS+.
+	Board string `yaml:"board"`
+	// Identity is a regular expression matched against the whole identity.
+	Identity string `yaml:"identity"`
+	// Subnet is a CIDR that the address of the device must be in.
+	Subnet string `yaml:"subnet"`
+
+	// Labels are added to every metric of the matched devices.
+	Labels map[string]string `yaml:"labels"`
+}
+
+// ResolverAddress returns resolver as host:port, defaulting to port 53.
+func ResolverAddress(resolver string) (string, error) {
+	host, port, err := net.SplitHostPort(resolver)
+	if err != nil {
+		host, port = resolver, "53"
+	}
+	if host == "" || strings.ContainsAny(host, "[]") || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+		return "", fmt.Errorf("invalid resolver address %q", resolver)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("invalid resolver port %q", port)
+	}
+
+	return net.JoinHostPort(host, port), nil
 }
 
 // Config represents the configuration for the exporter
 type Config struct {
-	Modules map[string]Module `yaml:"modules"`
+	Modules   map[string]Module   `yaml:"modules"`
+	Targets   map[string]Target   `yaml:"targets"`
+	SRVGroups map[string]SRVGroup `yaml:"srv_groups"`
+	MNDP      *MNDP               `yaml:"mndp"`
 }
 
-// Load reads YAML from reader and unmashals in Config
+// Load reads YAML from reader, unmashals it in Config and validates it.
+// The returned error lists every problem found.
 func Load(r io.Reader) (*Config, error) {
-	d := yaml.NewDecoder(r)
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	d := yaml.NewDecoder(bytes.NewReader(b))
 	d.KnownFields(true)
 
 	c := &Config{}
-	err := d.Decode(c)
+	err = d.Decode(c)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &yaml.Node{}
+	err = yaml.Unmarshal(b, root)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.validate(root)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,291 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModuleTimeout(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected time.Duration
+		hasError bool
+	}{
+		{"10s", 10 * time.Second, false},
+		{"1m30s", 90 * time.Second, false},
+		{"1.5s", 1500 * time.Millisecond, false},
+		{"500ms", 500 * time.Millisecond, false},
+		{"7", 7 * time.Second, false},
+		{"ten", 0, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.input, func(t *testing.T) {
+			c, err := Load(strings.NewReader("modules:\n  default:\n    username: prometheus\n    timeout: " + testCase.input + "\n"))
+			if testCase.hasError {
+				if err == nil {
+					t.Fatalf("expected an error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			if got := time.Duration(c.Modules["default"].Timeout); got != testCase.expected {
+				t.Errorf("expected %s, got %s", testCase.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "username")
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name: "modules",
+			input: `modules:
+  ok:
+    username: prometheus
+    password: changeme
+  nocreds:
+    tls: true
+  broken:
+    insecure_tls: true
+    username_file: ` + missing + `
+    firewall:
+      key: comment,name
+  overridden:
+    timeout: 10s
+targets:
+  core-rtr-1:
+    address: 192.0.2.1:8728
+    module: overridden
+    username: prometheus
+    password: changeme
+`,
+			expected: []string{
+				`line 5: module "nocreds": no username/password or username_file/password_file`,
+				`line 8: module "broken": insecure_tls is set but tls is not enabled`,
+				`line 9: module "broken": username_file is set but password_file is not`,
+				`line 9: module "broken": username_file is not readable`,
+				`line 11: module "broken": invalid firewall key "comment,name"`,
+			},
+		},
+		{
+			name: "targets",
+			input: `modules:
+  default:
+    username: prometheus
+    identity_label: true
+targets:
+  core-rtr-1:
+    address: 192.0.2.1:8728
+    module: default
+    labels:
+      site: dc1
+      instance: core
+  edge-rtr-1:
+    address: 192.0.2.2:8728
+    module: missing
+    password_file: /etc/mikrotik/password
+  edge-rtr-2:
+    module: default
+    labels:
+      __address__: 192.0.2.3
+  edge-rtr-3:
+    address: 192.0.2.4:8728
+    module: default
+    labels:
+      identity: edge-rtr-3
+`,
+			expected: []string{
+				`line 9: target "core-rtr-1": label "instance" is set to the name by the service discovery`,
+				`line 14: target "edge-rtr-1": unknown module "missing"`,
+				`line 15: target "edge-rtr-1": password_file is set but username_file is not`,
+				`line 15: target "edge-rtr-1": password_file is not readable`,
+				`line 16: target "edge-rtr-2": address is required`,
+				`line 18: target "edge-rtr-2": invalid label name "__address__"`,
+				`line 23: target "edge-rtr-3": label "identity" is added by module "default"`,
+			},
+		},
+		{
+			name: "srv groups",
+			input: `modules:
+  default:
+    username: prometheus
+targets:
+  branches:
+    address: 192.0.2.1:8728
+    module: default
+srv_groups:
+  branches:
+    record: _mikrotik._tcp.example.com
+    module: default
+  edge:
+    resolver: "[2001:db8::53"
+    module: default
+    labels:
+      address: edge
+      collector: edge
+`,
+			expected: []string{
+				`line 9: srv group "branches": name is already used by a target`,
+				`line 12: srv group "edge": record is required`,
+				`line 13: srv group "edge": invalid resolver address "[2001:db8::53"`,
+				`line 15: srv group "edge": label "collector" is reserved for the scrape metrics`,
+				`line 15: srv group "edge": label "address" is added to the devices of srv groups`,
+			},
+		},
+		{
+			name: "mndp",
+			input: `modules:
+  default:
+    username: prometheus
+mndp:
+  port: 70000
+  rules:
+    - module: default
+      identity: branch-.*
+    - module: missing
+      subnet: 192.0.2.0/33
+`,
+			expected: []string{
+				`line 5: mndp: port must be between 1 and 65535`,
+				`line 9: mndp rule 1: unknown module "missing"`,
+				`line 10: mndp rule 1: invalid subnet`,
+			},
+		},
+		{
+			name: "custom collectors",
+			input: `modules:
+  default:
+    username: prometheus
+    identity_label: true
+    custom_collectors:
+      vrrp:
+        path: /interface/vrrp
+        query:
+          - disabled=false
+        labels: [name, rx-byte, rx_byte, name, le, identity]
+        values:
+          - property: master
+            mapping: {"true": 1, "false": 0}
+          - property: priority
+            type: histogram
+          - property: uptime
+            name: master
+            conversion: hours
+`,
+			expected: []string{
+				`line 8: module "default": custom collector vrrp: query word "disabled=false" does not start with ?`,
+				`line 10: module "default": custom collector vrrp: duplicate label name "rx_byte"`,
+				`line 10: module "default": custom collector vrrp: duplicate label name "name"`,
+				`line 10: module "default": custom collector vrrp: label "le" is reserved for histograms and summaries`,
+				`line 10: module "default": custom collector vrrp: label "identity" is added by identity_label`,
+				`line 15: module "default": custom collector vrrp: value 1: type must be gauge or counter`,
+				`line 16: module "default": custom collector vrrp: value 2: duplicate metric name "master"`,
+				`line 18: module "default": custom collector vrrp: value 2: unknown conversion "hours"`,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := Load(strings.NewReader(testCase.input))
+			if err == nil {
+				t.Fatal("expected an error but got nil")
+			}
+
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(testCase.expected) {
+				t.Fatalf("expected %d problems, got %d:\n%s", len(testCase.expected), len(lines), err)
+			}
+			for i, e := range testCase.expected {
+				if !strings.HasPrefix(lines[i], e) {
+					t.Errorf("expected %q, got %q", e, lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestResolverAddress(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+		hasError bool
+	}{
+		{"192.0.2.53", "192.0.2.53:53", false},
+		{"192.0.2.53:5353", "192.0.2.53:5353", false},
+		{"2001:db8::53", "[2001:db8::53]:53", false},
+		{"[2001:db8::53]:5353", "[2001:db8::53]:5353", false},
+		{"ns1.example.com", "ns1.example.com:53", false},
+		{"192.0.2.53:dns", "", true},
+		{":53", "", true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.input, func(t *testing.T) {
+			addr, err := ResolverAddress(testCase.input)
+			if testCase.hasError && err == nil {
+				t.Fatalf("expected an error but got nil")
+			} else if !testCase.hasError && err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			if addr != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, addr)
+			}
+		})
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected []string
+		hasError bool
+	}{
+		{"mapping", "{bgp: true, routes: true, lte: false}", []string{"bgp", "routes"}, false},
+		{"list", "[bgp, routes]", []string{"bgp", "routes"}, false},
+		{"empty list", "[]", []string{}, false},
+		{"scalar", "bgp", nil, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			c, err := Load(strings.NewReader("modules:\n  default:\n    username: prometheus\n    features: " + testCase.input + "\n"))
+			if testCase.hasError {
+				if err == nil {
+					t.Fatalf("expected an error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			enabled := c.Modules["default"].Features.Enabled()
+			if strings.Join(enabled, ",") != strings.Join(testCase.expected, ",") {
+				t.Errorf("expected %v, got %v", testCase.expected, enabled)
+			}
+		})
+	}
+
+	c, err := Load(strings.NewReader("modules:\n  default:\n    username: prometheus\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Modules["default"].Features != nil {
+		t.Errorf("expected nil features when they are not set")
+	}
+}
@@ -0,0 +1,413 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// validate returns every semantic problem found in c. root is the document
+// c was decoded from and is used to point problems at line numbers.
+func (c *Config) validate(root *yaml.Node) error {
+	type located struct {
+		line int
+		err  error
+	}
+	found := []located{}
+	add := func(section, name string, problems []problem) {
+		for _, p := range problems {
+			line := keyLine(root, append([]string{section, name}, strings.Split(p.field, ".")...)...)
+			kind := strings.ReplaceAll(strings.TrimSuffix(section, "s"), "_", " ")
+			found = append(found, located{line, fmt.Errorf("line %d: %s %q: %s", line, kind, name, p.msg)})
+		}
+	}
+
+	for _, name := range sortedKeys(c.Modules) {
+		add("modules", name, c.Modules[name].problems(c.credentialsRequired(name)))
+	}
+	for _, name := range sortedKeys(c.Targets) {
+		add("targets", name, c.Targets[name].problems(c.Modules))
+	}
+	for _, name := range sortedKeys(c.SRVGroups) {
+		p := c.SRVGroups[name].problems(c.Modules)
+		if _, ok := c.Targets[name]; ok {
+			p = append(p, problem{"", "name is already used by a target"})
+		}
+		add("srv_groups", name, p)
+	}
+	if c.MNDP != nil {
+		for _, p := range c.MNDP.problems() {
+			line := keyLine(root, "mndp", p.field)
+			found = append(found, located{line, fmt.Errorf("line %d: mndp: %s", line, p.msg)})
+		}
+		for i, r := range c.MNDP.Rules {
+			for _, p := range r.problems(c.Modules) {
+				line := keyLine(root, "mndp", "rules", strconv.Itoa(i), p.field)
+				found = append(found, located{line, fmt.Errorf("line %d: mndp rule %d: %s", line, i, p.msg)})
+			}
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].line < found[j].line })
+
+	errs := make([]error, len(found))
+	for i, f := range found {
+		errs[i] = f.err
+	}
+
+	return errors.Join(errs...)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+type problem struct {
+	// YAML key the problem is reported at, empty for the module or target itself
+	field string
+	msg   string
+}
+
+// credentialsRequired returns whether module needs credentials of its own. A
+// module only used by targets that all override the credentials does not,
+// probing it by address is refused then.
+func (c *Config) credentialsRequired(module string) bool {
+	used := false
+	for _, t := range c.Targets {
+		if t.Module != module {
+			continue
+		}
+		if t.Username == "" && t.Password == "" && t.UsernameFile == "" && t.PasswordFile == "" {
+			return true
+		}
+		used = true
+	}
+	for _, g := range c.SRVGroups {
+		if g.Module == module {
+			return true
+		}
+	}
+	if c.MNDP != nil {
+		for _, r := range c.MNDP.Rules {
+			if r.Module == module {
+				return true
+			}
+		}
+	}
+
+	return !used
+}
+
+func (m Module) problems(requireCredentials bool) []problem {
+	p := credentialProblems(m.Username, m.Password, m.UsernameFile, m.PasswordFile, requireCredentials)
+
+	if m.CAFile != "" {
+		p = append(p, fileProblems("ca_file", m.CAFile)...)
+	}
+	if m.InsecureTLS && !m.TLS {
+		p = append(p, problem{"insecure_tls", "insecure_tls is set but tls is not enabled"})
+	}
+	if m.CAFile != "" && !m.TLS {
+		p = append(p, problem{"ca_file", "ca_file is set but tls is not enabled"})
+	}
+	if m.Timeout < 0 {
+		p = append(p, problem{"timeout", "timeout must not be negative"})
+	}
+	if m.Concurrency < 0 {
+		p = append(p, problem{"concurrency", "concurrency must not be negative"})
+	}
+	p = append(p, m.Interfaces.problems()...)
+	if strings.ContainsAny(m.Firewall.Key, ",= \t") {
+		p = append(p, problem{"firewall.key", fmt.Sprintf("invalid firewall key %q", m.Firewall.Key)})
+	}
+	for _, name := range sortedKeys(m.CustomCollectors) {
+		p = append(p, m.CustomCollectors[name].problems(name)...)
+		if m.IdentityLabel && slices.Contains(m.CustomCollectors[name].Labels, "identity") {
+			p = append(p, problem{"custom_collectors." + name + ".labels", fmt.Sprintf("custom collector %s: label \"identity\" is added by identity_label", name)})
+		}
+	}
+
+	return p
+}
+
+func (f InterfaceFilter) problems() []problem {
+	p := []problem{}
+
+	for _, r := range []struct{ field, value string }{
+		{"include", f.Include},
+		{"exclude", f.Exclude},
+		{"comment", f.Comment},
+		{"exclude_comment", f.ExcludeComment},
+	} {
+		if _, err := regexp.Compile(r.value); err != nil {
+			p = append(p, problem{"interfaces." + r.field, fmt.Sprintf("interfaces: invalid %s regexp: %s", r.field, err)})
+		}
+	}
+
+	return p
+}
+
+var customNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func (c CustomCollector) problems(name string) []problem {
+	p := []problem{}
+	field := "custom_collectors." + name
+
+	if !customNameRegex.MatchString(name) {
+		p = append(p, problem{field, fmt.Sprintf("invalid custom collector name %q", name)})
+	}
+	if !strings.HasPrefix(c.Path, "/") {
+		p = append(p, problem{field, fmt.Sprintf("custom collector %s: path must start with /", name)})
+	}
+	for _, q := range c.Query {
+		if !strings.HasPrefix(q, "?") {
+			p = append(p, problem{field + ".query", fmt.Sprintf("custom collector %s: query word %q does not start with ?", name, q)})
+		}
+	}
+	labels := map[string]bool{}
+	for _, l := range c.Labels {
+		label := strings.ReplaceAll(l, "-", "_")
+		switch {
+		case !model.LabelName(label).IsValid() || strings.HasPrefix(label, model.ReservedLabelPrefix):
+			p = append(p, problem{field + ".labels", fmt.Sprintf("custom collector %s: invalid label property %q", name, l)})
+		case label == model.BucketLabel || label == model.QuantileLabel:
+			p = append(p, problem{field + ".labels", fmt.Sprintf("custom collector %s: label %q is reserved for histograms and summaries", name, label)})
+		case labels[label]:
+			p = append(p, problem{field + ".labels", fmt.Sprintf("custom collector %s: duplicate label name %q", name, label)})
+		}
+		labels[label] = true
+	}
+	if len(c.Values) == 0 {
+		p = append(p, problem{field, fmt.Sprintf("custom collector %s: no values", name)})
+	}
+
+	metrics := map[string]bool{}
+	for i, v := range c.Values {
+		vField := fmt.Sprintf("%s.values.%d", field, i)
+		if v.Property == "" {
+			p = append(p, problem{vField, fmt.Sprintf("custom collector %s: value %d: property is required", name, i)})
+		}
+		metric := v.Name
+		if metric == "" {
+			metric = strings.ReplaceAll(v.Property, "-", "_")
+		}
+		if metric != "" && !customNameRegex.MatchString(metric) {
+			p = append(p, problem{vField, fmt.Sprintf("custom collector %s: value %d: invalid metric name %q", name, i, metric)})
+		}
+		if metrics[metric] {
+			p = append(p, problem{vField, fmt.Sprintf("custom collector %s: value %d: duplicate metric name %q", name, i, metric)})
+		}
+		metrics[metric] = true
+		if v.Type != "" && v.Type != "gauge" && v.Type != "counter" {
+			p = append(p, problem{vField + ".type", fmt.Sprintf("custom collector %s: value %d: type must be gauge or counter", name, i)})
+		}
+		if v.Conversion != "" && v.Conversion != "duration" {
+			p = append(p, problem{vField + ".conversion", fmt.Sprintf("custom collector %s: value %d: unknown conversion %q", name, i, v.Conversion)})
+		}
+	}
+
+	return p
+}
+
+func (t Target) problems(modules map[string]Module) []problem {
+	p := credentialProblems(t.Username, t.Password, t.UsernameFile, t.PasswordFile, false)
+
+	if t.Address == "" {
+		p = append(p, problem{"", "address is required"})
+	}
+	p = append(p, moduleProblems(t.Module, modules)...)
+	p = append(p, labelProblems(t.Labels)...)
+	p = append(p, identityLabelProblems(t.Module, modules, t.Labels)...)
+
+	return p
+}
+
+func (g SRVGroup) problems(modules map[string]Module) []problem {
+	p := []problem{}
+
+	if g.Record == "" {
+		p = append(p, problem{"", "record is required"})
+	}
+	if g.Resolver != "" {
+		if _, err := ResolverAddress(g.Resolver); err != nil {
+			p = append(p, problem{"resolver", err.Error()})
+		}
+	}
+	p = append(p, moduleProblems(g.Module, modules)...)
+	p = append(p, labelProblems(g.Labels)...)
+	if _, ok := g.Labels["address"]; ok {
+		p = append(p, problem{"labels", `label "address" is added to the devices of srv groups`})
+	}
+	p = append(p, identityLabelProblems(g.Module, modules, g.Labels)...)
+
+	return p
+}
+
+func (m MNDP) problems() []problem {
+	p := []problem{}
+
+	if m.Listen != "" {
+		if _, err := net.ResolveUDPAddr("udp", m.Listen); err != nil {
+			p = append(p, problem{"listen", fmt.Sprintf("invalid listen address: %s", err)})
+		}
+	}
+	if m.Port < 0 || m.Port > 65535 {
+		p = append(p, problem{"port", "port must be between 1 and 65535"})
+	}
+	if m.Expire < 0 {
+		p = append(p, problem{"expire", "expire must not be negative"})
+	}
+
+	return p
+}
+
+func (r MNDPRule) problems(modules map[string]Module) []problem {
+	p := moduleProblems(r.Module, modules)
+
+	if r.Identity != "" {
+		if _, err := regexp.Compile(r.Identity); err != nil {
+			p = append(p, problem{"identity", fmt.Sprintf("invalid identity regexp: %s", err)})
+		}
+	}
+	if r.Subnet != "" {
+		if _, err := netip.ParsePrefix(r.Subnet); err != nil {
+			p = append(p, problem{"subnet", fmt.Sprintf("invalid subnet: %s", err)})
+		}
+	}
+	p = append(p, labelProblems(r.Labels)...)
+	p = append(p, identityLabelProblems(r.Module, modules, r.Labels)...)
+
+	return p
+}
+
+func moduleProblems(module string, modules map[string]Module) []problem {
+	if module == "" {
+		return []problem{{"", "module is required"}}
+	}
+	if _, ok := modules[module]; !ok {
+		return []problem{{"module", fmt.Sprintf("unknown module %q", module)}}
+	}
+
+	return nil
+}
+
+func labelProblems(labels map[string]string) []problem {
+	p := []problem{}
+
+	for _, name := range sortedKeys(labels) {
+		switch {
+		case !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix):
+			p = append(p, problem{"labels", fmt.Sprintf("invalid label name %q", name)})
+		case name == "collector":
+			p = append(p, problem{"labels", fmt.Sprintf("label %q is reserved for the scrape metrics", name)})
+		case name == "instance":
+			p = append(p, problem{"labels", fmt.Sprintf("label %q is set to the name by the service discovery", name)})
+		}
+	}
+
+	return p
+}
+
+// identityLabelProblems reports labels clashing with the identity label added
+// by module.
+func identityLabelProblems(module string, modules map[string]Module, labels map[string]string) []problem {
+	if _, ok := labels["identity"]; ok && modules[module].IdentityLabel {
+		return []problem{{"labels", fmt.Sprintf("label \"identity\" is added by module %q", module)}}
+	}
+
+	return nil
+}
+
+func credentialProblems(username, password, usernameFile, passwordFile string, required bool) []problem {
+	p := []problem{}
+
+	hasCredentials := username != "" || password != ""
+	hasCredentialFiles := usernameFile != "" || passwordFile != ""
+	switch {
+	case !hasCredentials && !hasCredentialFiles:
+		if required {
+			p = append(p, problem{"", "no username/password or username_file/password_file"})
+		}
+	case hasCredentials && hasCredentialFiles:
+		p = append(p, problem{"username_file", "username/password and username_file/password_file are mutually exclusive"})
+	case usernameFile != "" && passwordFile == "":
+		p = append(p, problem{"username_file", "username_file is set but password_file is not"})
+	case passwordFile != "" && usernameFile == "":
+		p = append(p, problem{"password_file", "password_file is set but username_file is not"})
+	}
+
+	if usernameFile != "" {
+		p = append(p, fileProblems("username_file", usernameFile)...)
+	}
+	if passwordFile != "" {
+		p = append(p, fileProblems("password_file", passwordFile)...)
+	}
+
+	return p
+}
+
+func fileProblems(field, name string) []problem {
+	f, err := os.Open(name)
+	if err != nil {
+		return []problem{{field, fmt.Sprintf("%s is not readable: %s", field, err)}}
+	}
+	f.Close()
+
+	return nil
+}
+
+// keyLine returns the line of the deepest key of path found in root. Keys of
+// sequences are indexes.
+func keyLine(root *yaml.Node, path ...string) int {
+	line := 0
+	n := root
+	if n != nil && n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+
+	for _, key := range path {
+		if n == nil || key == "" {
+			break
+		}
+
+		if n.Kind == yaml.SequenceNode {
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(n.Content) {
+				break
+			}
+			n = n.Content[i]
+			line = n.Line
+			continue
+		}
+		if n.Kind != yaml.MappingNode {
+			break
+		}
+
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				line = n.Content[i].Line
+				next = n.Content[i+1]
+				break
+			}
+		}
+		n = next
+	}
+
+	return line
+}
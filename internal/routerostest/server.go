@@ -0,0 +1,451 @@
+// Package routerostest implements an in-process RouterOS API server that
+// serves canned replies, for use in collector tests.
+package routerostest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-routeros/routeros/v3/proto"
+	yaml "gopkg.in/yaml.v3"
+)
+
+const (
+	wordRe   = "!re"
+	wordDone = "!done"
+	wordTrap = "!trap"
+
+	// TrapNoSuchCommand is the message RouterOS returns for unknown menus.
+	TrapNoSuchCommand = "no such command prefix"
+)
+
+// Reply is a canned reply to a single API command.
+type Reply struct {
+	// Command is the command word, e.g. /interface/print.
+	Command string `yaml:"command"`
+	// Query must equal the query words (?...) of the request, in any order.
+	Query []string `yaml:"query"`
+	// Args must be a subset of the attribute words (=key=value) of the request.
+	Args map[string]string `yaml:"args"`
+
+	Re   []map[string]string `yaml:"re"`
+	Done map[string]string   `yaml:"done"`
+	// Trap, if set, is returned as the message of a !trap sentence.
+	Trap string `yaml:"trap"`
+	// Delay is how long the server waits before replying.
+	Delay time.Duration `yaml:"delay"`
+}
+
+// LoadFile reads a list of replies from a YAML fixture file.
+func LoadFile(path string) ([]Reply, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	replies := []Reply{}
+	err = yaml.Unmarshal(b, &replies)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return replies, nil
+}
+
+// Server is a RouterOS API server listening on the loopback interface.
+type Server struct {
+	ln      net.Listener
+	replies []Reply
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	commands []string
+	logins   int
+	username string
+	password string
+
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+// NewServer starts a server serving replies. It is closed when the test ends.
+func NewServer(tb testing.TB, replies []Reply) *Server {
+	tb.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("routerostest: listen: %v", err)
+	}
+
+	s := &Server{
+		ln:      ln,
+		replies: replies,
+		conns:   make(map[net.Conn]struct{}),
+		done:    make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	tb.Cleanup(s.Close)
+
+	return s
+}
+
+// Addr returns the host:port the server is listening on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Commands returns the command words received so far, excluding /login.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.commands)
+}
+
+// SetCredentials makes the server reject logins with other credentials.
+// By default any credentials are accepted.
+func (s *Server) SetCredentials(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.username = username
+	s.password = password
+}
+
+// Logins returns the number of /login commands received so far.
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.logins
+}
+
+// CloseConnections closes all open connections, leaving the listener open.
+func (s *Server) CloseConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		_ = c.Close()
+	}
+}
+
+// Close stops the listener and closes all open connections.
+func (s *Server) Close() {
+	select {
+	case <-s.done:
+		return
+	default:
+		close(s.done)
+	}
+
+	_ = s.ln.Close()
+	s.CloseConnections()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
+
+// request is a parsed API command sentence.
+type request struct {
+	command string
+	tag     string
+	query   []string
+	args    map[string]string
+}
+
+// connWriter serializes the replies written to one connection.
+type connWriter struct {
+	mu sync.Mutex
+	w  proto.Writer
+	// closed once the connection stops reading commands
+	closed chan struct{}
+}
+
+// handle serves the commands of conn. Tagged commands are replied to
+// concurrently like on a device, so a delayed reply does not hold up the
+// others.
+func (s *Server) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := &connWriter{w: proto.NewWriter(conn), closed: make(chan struct{})}
+	defer w.w.Close()
+
+	var pending sync.WaitGroup
+	defer pending.Wait()
+	defer close(w.closed)
+
+	for {
+		req, err := readRequest(r)
+		if err != nil {
+			return
+		}
+
+		if req.command == "/login" {
+			w.mu.Lock()
+			err = s.login(w.w, req)
+			w.mu.Unlock()
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, req.command)
+		s.mu.Unlock()
+
+		if req.tag == "" {
+			if err := s.reply(w, req); err != nil {
+				return
+			}
+			continue
+		}
+
+		pending.Add(1)
+		go func() {
+			defer pending.Done()
+			if err := s.reply(w, req); err != nil {
+				_ = conn.Close()
+			}
+		}()
+	}
+}
+
+func (s *Server) login(w proto.Writer, req *request) error {
+	s.mu.Lock()
+	s.logins++
+	rejected := s.username != "" && (req.args["name"] != s.username || req.args["password"] != s.password)
+	s.mu.Unlock()
+
+	if rejected {
+		err := writeSentence(w, wordTrap, req.tag, map[string]string{"message": "invalid user name or password (6)"})
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeSentence(w, wordDone, req.tag, nil)
+}
+
+func (s *Server) reply(cw *connWriter, req *request) error {
+	rep := s.match(req)
+	if rep == nil {
+		rep = &Reply{Trap: TrapNoSuchCommand}
+	}
+
+	if rep.Delay > 0 {
+		select {
+		case <-time.After(rep.Delay):
+		case <-cw.closed:
+			return errors.New("connection closed")
+		case <-s.done:
+			return errors.New("server closed")
+		}
+	}
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	w := cw.w
+
+	if rep.Trap != "" {
+		err := writeSentence(w, wordTrap, req.tag, map[string]string{"message": rep.Trap})
+		if err != nil {
+			return err
+		}
+		return writeSentence(w, wordDone, req.tag, nil)
+	}
+
+	done := rep.Done
+	if _, ok := req.args["count-only"]; ok && done["ret"] == "" {
+		done = map[string]string{"ret": fmt.Sprint(len(rep.Re))}
+	} else {
+		proplist := req.args[".proplist"]
+		for _, re := range rep.Re {
+			err := writeSentence(w, wordRe, req.tag, filterProps(re, proplist))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return writeSentence(w, wordDone, req.tag, done)
+}
+
+func (s *Server) match(req *request) *Reply {
+	query := slices.Clone(req.query)
+	sort.Strings(query)
+
+	for i := range s.replies {
+		rep := &s.replies[i]
+		if rep.Command != req.command {
+			continue
+		}
+
+		want := slices.Clone(rep.Query)
+		sort.Strings(want)
+		if !slices.Equal(want, query) {
+			continue
+		}
+
+		matches := true
+		for k, v := range rep.Args {
+			if got, ok := req.args[k]; !ok || got != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return rep
+		}
+	}
+
+	return nil
+}
+
+func filterProps(props map[string]string, proplist string) map[string]string {
+	if proplist == "" {
+		return props
+	}
+
+	filtered := make(map[string]string)
+	for _, p := range strings.Split(proplist, ",") {
+		if v, ok := props[p]; ok {
+			filtered[p] = v
+		}
+	}
+
+	return filtered
+}
+
+func writeSentence(w proto.Writer, word, tag string, attrs map[string]string) error {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w.BeginSentence()
+	w.WriteWord(word)
+	for _, k := range keys {
+		w.WriteWord("=" + k + "=" + attrs[k])
+	}
+	if tag != "" {
+		w.WriteWord(".tag=" + tag)
+	}
+
+	return w.EndSentence()
+}
+
+func readRequest(r *bufio.Reader) (*request, error) {
+	req := &request{args: make(map[string]string)}
+
+	for {
+		word, err := readWord(r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case word == "":
+			if req.command == "" {
+				// empty sentences are ignored
+				continue
+			}
+			return req, nil
+		case req.command == "":
+			req.command = word
+		case strings.HasPrefix(word, ".tag="):
+			req.tag = strings.TrimPrefix(word, ".tag=")
+		case strings.HasPrefix(word, "?"):
+			req.query = append(req.query, word)
+		case strings.HasPrefix(word, "="):
+			k, v, _ := strings.Cut(word[1:], "=")
+			req.args[k] = v
+		default:
+			return nil, fmt.Errorf("invalid word: %q", word)
+		}
+	}
+}
+
+func readWord(r *bufio.Reader) (string, error) {
+	l, err := readLength(r)
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, l)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func readLength(r *bufio.Reader) (int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	var extra int
+	l := int(first)
+	switch {
+	case first&0x80 == 0x00:
+	case first&0xC0 == 0x80:
+		extra, l = 1, l&^0xC0
+	case first&0xE0 == 0xC0:
+		extra, l = 2, l&^0xE0
+	case first&0xF0 == 0xE0:
+		extra, l = 3, l&^0xF0
+	case first == 0xF0:
+		extra, l = 4, 0
+	default:
+		return 0, errors.New("invalid length prefix")
+	}
+
+	for i := 0; i < extra; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		l = l<<8 | int(b)
+	}
+
+	return l, nil
+}
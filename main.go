@@ -10,6 +10,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/collectors/version"
 
@@ -17,24 +20,42 @@ import (
 	"mikrotik-exporter/config"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // single device can be defined via CLI flags, multiple via config file.
 var (
-	configFile = flag.String("config", "config.yml", "config file to load")
-	logFormat  = flag.String("log-format", "text", "logformat text or json (default json)")
-	logLevel   = flag.String("log-level", "info", "log level")
-	addr       = flag.String("port", ":9436", "port number to listen on")
-	ver        = flag.Bool("version", false, "find the version of binary")
+	configFile     = flag.String("config", "config.yml", "config file to load")
+	logFormat      = flag.String("log-format", "text", "logformat text or json (default json)")
+	logLevel       = flag.String("log-level", "info", "log level")
+	addr           = flag.String("port", ":9436", "port number to listen on")
+	ver            = flag.Bool("version", false, "find the version of binary")
+	checkConfig    = flag.Bool("check-config", false, "validate the config file and exit")
+	listCollectors = flag.Bool("list-collectors", false, "list the available collectors and their metrics and exit")
+	externalAddr   = flag.String("external-address", "", "host:port Prometheus reaches the exporter at, published by /sd (default the Host header of the request)")
+	timeoutOffset  = flag.Duration("timeout-offset", 500*time.Millisecond, "offset to subtract from the Prometheus scrape timeout")
 
 	cfg *config.Config
 
+	// serializes config reloads
+	reloadMu sync.Mutex
+
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mikrotik_exporter_config_last_reload_successful",
+		Help: "Whether the last configuration reload attempt was successful",
+	})
+	configReloadSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mikrotik_exporter_config_last_reload_success_timestamp_seconds",
+		Help: "Timestamp of the last successful configuration reload",
+	})
+
 	appVersion = "DEVELOPMENT"
 	shortSha   = "0xDEADBEEF"
 )
 
 func init() {
 	prometheus.MustRegister(version.NewCollector("mikrotik_exporter"))
+	prometheus.MustRegister(configReloadSuccess, configReloadSeconds)
 }
 
 func main() {
@@ -45,8 +66,20 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *listCollectors {
+		if err := collector.PrintCollectors(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	configureLog()
 
+	if *checkConfig {
+		os.Exit(runCheckConfig())
+	}
+
 	c, err := loadConfig()
 	if err != nil {
 		slog.Error("Could not load config", "err", err)
@@ -83,16 +116,80 @@ func loadConfig() (*config.Config, error) {
 	return config.Load(bytes.NewReader(b))
 }
 
+// runCheckConfig validates the config file and returns the exit code.
+func runCheckConfig() int {
+	c, err := loadConfig()
+	if err == nil {
+		err = collector.CheckConfig(c)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid config:\n%s\n", *configFile, err)
+		return 1
+	}
+
+	fmt.Printf("%s: config OK\n", *configFile)
+	return 0
+}
+
+// reloadConfig loads the config file and applies it to p. The current config is
+// kept if the new one is invalid.
+func reloadConfig(p *collector.Prober) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	c, err := loadConfig()
+	if err == nil {
+		err = p.Reload(c)
+	}
+	if err != nil {
+		configReloadSuccess.Set(0)
+		return err
+	}
+
+	cfg = c
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+
+	return nil
+}
+
 func startServer() {
 	p, err := collector.NewProber(cfg)
 	if err != nil {
 		slog.Error("error creating prober", "err", err)
 		os.Exit(1)
 	}
+	p.TimeoutOffset = *timeoutOffset
+	prometheus.MustRegister(p)
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			if err := reloadConfig(p); err != nil {
+				slog.Error("error reloading config", "err", err)
+			} else {
+				slog.Info("Reloaded config", "file", *configFile)
+			}
+		}
+	}()
 
 	mux := http.NewServeMux()
 
 	mux.Handle("GET /probe", p)
+	mux.Handle("GET /sd", p.SDHandler(*externalAddr))
+	mux.Handle("GET /metrics", promhttp.Handler())
+
+	mux.HandleFunc("POST /-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if err := reloadConfig(p); err != nil {
+			slog.Error("error reloading config", "err", err)
+			http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+			return
+		}
+		slog.Info("Reloaded config", "file", *configFile)
+	})
 
 	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte("ok"))
@@ -103,6 +200,7 @@ func startServer() {
 			<head><title>Mikrotik Exporter</title></head>
 			<body>
 			<h1>Mikrotik Exporter</h1>
+			<p><a href="/metrics">Metrics</a></p>
 			</body>
 			</html>`))
 	})
@@ -123,6 +221,9 @@ func startServer() {
 			// Error from closing listeners, or context timeout:
 			log.Printf("HTTP server Shutdown: %v", err)
 		}
+		// no probe runs anymore, close the pooled sessions, the srv
+		// lookups and the mndp listener
+		p.Close()
 		close(idleConnsClosed)
 	}()
 